@@ -8,47 +8,66 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"strings"
+
+	"github.com/costrouc/go-jupyterlab-api/nbformat"
 )
 
-func CreateClient(config *ClientConfig) (*ClientConfig, error) {
+func CreateClient(config *ClientConfig, options ...ClientOption) (*ClientConfig, error) {
 	clientConfig := ClientConfig{
-		ApiToken: "",
-		ApiURL:   "http://localhost:8888/api",
+		ApiToken:        config.ApiToken,
+		ApiURL:          config.ApiURL,
+		HTTPClient:      config.HTTPClient,
+		UserAgent:       config.UserAgent,
+		RetryPolicy:     config.RetryPolicy,
+		Authenticator:   config.Authenticator,
+		WebsocketDialer: config.WebsocketDialer,
+	}
+	if clientConfig.HTTPClient == nil {
+		clientConfig.HTTPClient = &http.Client{}
+	}
+	for _, option := range options {
+		if err := option(&clientConfig); err != nil {
+			return nil, err
+		}
+	}
+	// the jar is installed after every option so a later WithHTTPClient
+	// does not drop it
+	if clientConfig.cookieJar != nil {
+		client := *clientConfig.httpClient()
+		client.Jar = clientConfig.cookieJar
+		clientConfig.HTTPClient = &client
+	}
+
+	if clientConfig.ApiURL == "" {
+		clientConfig.ApiURL = discoverApiURL(clientConfig.url, clientConfig.baseURL)
 	}
+	clientConfig.ApiURL = strings.TrimSuffix(clientConfig.ApiURL, "/")
 
-	if config.ApiToken != "" {
-		clientConfig.ApiToken = config.ApiToken
-	} else {
-		apiToken, ok := os.LookupEnv("JUPYTERLAB_API_TOKEN")
+	if clientConfig.ApiToken == "" && clientConfig.Authenticator == nil && clientConfig.cookieJar == nil {
+		apiToken, ok := discoverApiToken()
 		if !ok {
-			return nil, errors.New("api token not defined can be set via JUPYTERLAB_API_TOKEN")
+			return nil, errors.New("api token not defined can be set via JUPYTERLAB_API_TOKEN, JUPYTER_TOKEN or JPY_API_TOKEN")
 		}
 		clientConfig.ApiToken = apiToken
 	}
 	return &clientConfig, nil
 }
 
+// serverURL is the root of the jupyter server, endpoints such as
+// /terminals/websocket and /files live outside of /api.
+func (c *ClientConfig) serverURL() string {
+	return strings.TrimSuffix(c.ApiURL, "/api")
+}
+
 func (c *ClientConfig) Request(ctx context.Context, method string, path string, contentType string, requestBody []byte) ([]byte, error) {
 	url := fmt.Sprintf("%s/%s", c.ApiURL, path)
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(requestBody))
-	req = req.WithContext(ctx)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.ApiToken))
-	req.Header.Set("Content-Type", contentType)
-	resp, err := client.Do(req)
+	resp, err := c.do(ctx, method, url, contentType, requestBody)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("response returned status code of %d instead of 2XX", resp.StatusCode)
-	}
-
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -56,6 +75,62 @@ func (c *ClientConfig) Request(ctx context.Context, method string, path string,
 	return body, nil
 }
 
+// do sends the request returning the response with an unread body, the
+// caller must close it. Non 2XX responses are returned as an *APIError.
+func (c *ClientConfig) do(ctx context.Context, method string, url string, contentType string, requestBody []byte) (*http.Response, error) {
+	refreshed := false
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(requestBody))
+		if err != nil {
+			return nil, err
+		}
+		if err := c.setAuthHeaders(req); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		if c.UserAgent != "" {
+			req.Header.Set("User-Agent", c.UserAgent)
+		}
+		resp, err := c.httpClient().Do(req)
+
+		if c.RetryPolicy != nil && ctx.Value(noRetryKey{}) == nil && ctx.Err() == nil {
+			if delay, retry := c.RetryPolicy.Retry(req, resp, err, attempt); retry {
+				if resp != nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+				if err := sleepContext(ctx, delay); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if refresher, ok := c.Authenticator.(Refresher); ok && !refreshed && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			refreshed = true
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if err := refresher.Refresh(ctx); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return nil, err
+			}
+			return nil, newAPIError(resp, body)
+		}
+		return resp, nil
+	}
+}
+
 func (c *ClientConfig) GetVersion(ctx context.Context) (*GetVersionResponse, error) {
 	data, err := c.Request(ctx, http.MethodGet, "", "application/json", nil)
 	if err != nil {
@@ -82,8 +157,13 @@ func (c *ClientConfig) GetStatus(ctx context.Context) (*GetStatusResponse, error
 	return &result, nil
 }
 
-func (c *ClientConfig) GetMe(ctx context.Context) (*GetMeResponse, error) {
-	data, err := c.Request(ctx, http.MethodGet, "me", "application/json", nil)
+func (c *ClientConfig) GetMe(ctx context.Context, options *GetMeParams) (*GetMeResponse, error) {
+	url := "me"
+	if options != nil {
+		url = fmt.Sprintf("me?%s", options.Encode())
+	}
+
+	data, err := c.Request(ctx, http.MethodGet, url, "application/json", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -170,6 +250,25 @@ func (c *ClientConfig) PutContents(ctx context.Context, path string, options *Pu
 	return &result, nil
 }
 
+func (c *ClientConfig) GetNotebook(ctx context.Context, path string) (*nbformat.Notebook, error) {
+	result, err := c.GetContents(ctx, path, &GetContentsParams{Type: "notebook", Content: 1})
+	if err != nil {
+		return nil, err
+	}
+	if result.Notebook() == nil {
+		return nil, fmt.Errorf("notebook %s returned no content", path)
+	}
+	return result.Notebook(), nil
+}
+
+func (c *ClientConfig) PutNotebook(ctx context.Context, path string, notebook *nbformat.Notebook) (*PutContentsResponse, error) {
+	return c.PutContents(ctx, path, &PutContentsBody{
+		Content: notebook,
+		Format:  "json",
+		Type:    "notebook",
+	})
+}
+
 func (c *ClientConfig) DeleteContents(ctx context.Context, path string) error {
 	url := fmt.Sprintf("contents/%s", path)
 	_, err := c.Request(ctx, http.MethodDelete, url, "application/json", nil)
@@ -179,7 +278,51 @@ func (c *ClientConfig) DeleteContents(ctx context.Context, path string) error {
 	return nil
 }
 
-// TODO: Contents Checkpoint API
+func (c *ClientConfig) ListCheckpoints(ctx context.Context, path string) (*ListCheckpointsResponse, error) {
+	url := fmt.Sprintf("contents/%s/checkpoints", path)
+	data, err := c.Request(ctx, http.MethodGet, url, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result ListCheckpointsResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *ClientConfig) CreateCheckpoint(ctx context.Context, path string) (*CreateCheckpointResponse, error) {
+	url := fmt.Sprintf("contents/%s/checkpoints", path)
+	data, err := c.Request(ctx, http.MethodPost, url, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result CreateCheckpointResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *ClientConfig) RestoreCheckpoint(ctx context.Context, path string, checkpoint string) error {
+	url := fmt.Sprintf("contents/%s/checkpoints/%s", path, checkpoint)
+	_, err := c.Request(ctx, http.MethodPost, url, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *ClientConfig) DeleteCheckpoint(ctx context.Context, path string, checkpoint string) error {
+	url := fmt.Sprintf("contents/%s/checkpoints/%s", path, checkpoint)
+	_, err := c.Request(ctx, http.MethodDelete, url, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
 
 func (c *ClientConfig) GetSessions(ctx context.Context) (*GetSessionsResponse, error) {
 	data, err := c.Request(ctx, http.MethodGet, "sessions", "application/json", nil)
@@ -194,8 +337,8 @@ func (c *ClientConfig) GetSessions(ctx context.Context) (*GetSessionsResponse, e
 	return &result, nil
 }
 
-func (c *ClientConfig) CreateSession(ctx context.Context, session *Session) (*CreateSessionResponse, error) {
-	body, err := json.Marshal(session)
+func (c *ClientConfig) CreateSession(ctx context.Context, options *CreateSessionBody) (*CreateSessionResponse, error) {
+	body, err := json.Marshal(options)
 	if err != nil {
 		return nil, err
 	}
@@ -226,7 +369,7 @@ func (c *ClientConfig) GetSession(ctx context.Context, session string) (*GetSess
 	return &result, nil
 }
 
-func (c *ClientConfig) PatchSession(ctx context.Context, session string, options *Session) (*PatchSessionResponse, error) {
+func (c *ClientConfig) PatchSession(ctx context.Context, session string, options *PatchSessionBody) (*PatchSessionResponse, error) {
 	body, err := json.Marshal(options)
 	if err != nil {
 		return nil, err
@@ -245,6 +388,22 @@ func (c *ClientConfig) PatchSession(ctx context.Context, session string, options
 	return &result, nil
 }
 
+// FindSessionByPath returns the session attached to path or nil when there
+// is none, so the kernel of an open notebook can be reused.
+func (c *ClientConfig) FindSessionByPath(ctx context.Context, path string) (*Session, error) {
+	sessions, err := c.GetSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range *sessions {
+		if session.Path == path {
+			return &session, nil
+		}
+	}
+	return nil, nil
+}
+
 func (c *ClientConfig) DeleteSession(ctx context.Context, session string) error {
 	url := fmt.Sprintf("sessions/%s", session)
 	_, err := c.Request(ctx, http.MethodDelete, url, "application/json", nil)
@@ -267,6 +426,32 @@ func (c *ClientConfig) GetKernelSpecs(ctx context.Context) (*GetKernelSpecsRespo
 	return &result, nil
 }
 
+func (c *ClientConfig) GetKernelSpec(ctx context.Context, kernelSpec string) (*GetKernelSpecResponse, error) {
+	url := fmt.Sprintf("kernelspecs/%s", kernelSpec)
+	data, err := c.Request(ctx, http.MethodGet, url, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result GetKernelSpecResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetKernelSpecResource fetches a file from the kernel spec directory such as
+// logo-64x64.png, these are served outside of /api.
+func (c *ClientConfig) GetKernelSpecResource(ctx context.Context, kernelSpec string, file string) ([]byte, error) {
+	url := fmt.Sprintf("%s/kernelspecs/%s/%s", c.serverURL(), kernelSpec, file)
+	resp, err := c.do(ctx, http.MethodGet, url, "application/octet-stream", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
 func (c *ClientConfig) GetKernels(ctx context.Context) (*GetKernelsResponse, error) {
 	data, err := c.Request(ctx, http.MethodGet, "kernels", "application/json", nil)
 	if err != nil {
@@ -338,7 +523,40 @@ func (c *ClientConfig) RestartKernel(ctx context.Context, kernel string) error {
 	return nil
 }
 
-// TODO: GET and PATCH /api/config/...
+func (c *ClientConfig) GetConfigSection(ctx context.Context, section string) (*GetConfigSectionResponse, error) {
+	url := fmt.Sprintf("config/%s", section)
+	data, err := c.Request(ctx, http.MethodGet, url, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result GetConfigSectionResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PatchConfigSection recursively merges patch into the section, keys set to
+// nil are removed from the stored config.
+func (c *ClientConfig) PatchConfigSection(ctx context.Context, section string, patch ConfigSection) (*PatchConfigSectionResponse, error) {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("config/%s", section)
+	data, err := c.Request(ctx, http.MethodPatch, url, "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result PatchConfigSectionResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
 
 func (c *ClientConfig) GetTerminals(ctx context.Context) (*GetTerminalsResponse, error) {
 	data, err := c.Request(ctx, http.MethodGet, "terminals", "application/json", nil)
@@ -1,10 +1,25 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/costrouc/go-jupyterlab-api/nbformat"
 )
 
 func TestGetVersion(t *testing.T) {
@@ -22,6 +37,313 @@ func TestGetVersion(t *testing.T) {
 	}
 }
 
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCreateClientOptions(t *testing.T) {
+	var userAgent, authorization string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		userAgent = req.Header.Get("User-Agent")
+		authorization = req.Header.Get("Authorization")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"version": "2.0.0"}`)),
+			Request:    req,
+		}, nil
+	})
+	client, err := CreateClient(
+		&ClientConfig{ApiToken: "faketoken"},
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithTimeout(5*time.Second),
+		WithUserAgent("go-jupyterlab-api-test"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.HTTPClient.Timeout != 5*time.Second {
+		t.Errorf("Expected http client timeout of 5s, got %s", client.HTTPClient.Timeout)
+	}
+
+	ctx := context.Background()
+	data, err := client.GetVersion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Version != "2.0.0" {
+		t.Errorf("Expected version 2.0.0 from injected transport, got %s", data.Version)
+	}
+	if userAgent != "go-jupyterlab-api-test" {
+		t.Errorf("Expected user agent go-jupyterlab-api-test, got %s", userAgent)
+	}
+	if authorization != "Bearer faketoken" {
+		t.Errorf("Expected bearer token authorization header, got %s", authorization)
+	}
+
+	if _, err := CreateClient(&ClientConfig{ApiToken: "faketoken"}, WithHTTPClient(&http.Client{Transport: transport}), WithTLSConfig(&tls.Config{})); err == nil {
+		t.Errorf("Expected tls config to be rejected for a non *http.Transport")
+	}
+}
+
+func TestCreateClientDiscovery(t *testing.T) {
+	for _, name := range []string{"JUPYTERLAB_API_TOKEN", "JUPYTER_TOKEN", "JPY_API_TOKEN", "JUPYTERHUB_API_TOKEN", "JUPYTER_SERVER_URL", "JUPYTERHUB_API_URL", "JUPYTERHUB_SERVICE_URL", "JUPYTERHUB_SERVICE_PREFIX"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken", ApiURL: "http://example.com/api/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.ApiURL != "http://example.com/api" {
+		t.Errorf("Expected provided ApiURL to be honored, got %s", client.ApiURL)
+	}
+
+	client, err = CreateClient(&ClientConfig{}, WithToken("faketoken"), WithURL("http://example.com:8000"), WithBaseURL("/user/alice/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.ApiURL != "http://example.com:8000/user/alice/api" {
+		t.Errorf("Expected base url to prefix api url, got %s", client.ApiURL)
+	}
+
+	if _, err := CreateClient(&ClientConfig{}); err == nil {
+		t.Errorf("Expected missing api token to return an error")
+	}
+
+	t.Setenv("JUPYTERHUB_API_URL", "http://hub:8081/hub/api")
+	t.Setenv("JUPYTERHUB_SERVICE_PREFIX", "/user/alice/")
+	t.Setenv("JPY_API_TOKEN", "hubtoken")
+	client, err = CreateClient(&ClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.ApiURL != "http://localhost:8888/user/alice/api" || client.ApiToken != "hubtoken" {
+		t.Errorf("Expected JupyterHub single-user discovery, got %s with token %s", client.ApiURL, client.ApiToken)
+	}
+
+	t.Setenv("JUPYTER_SERVER_URL", "http://lab:9999/")
+	client, err = CreateClient(&ClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.ApiURL != "http://lab:9999/user/alice/api" {
+		t.Errorf("Expected JUPYTER_SERVER_URL discovery, got %s", client.ApiURL)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	attempts := map[string]int{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts[req.Method]++
+		if attempts[req.Method] < 3 {
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Header:     http.Header{"Retry-After": {"0"}},
+				Body:       io.NopCloser(strings.NewReader(`{"message": "starting"}`)),
+				Request:    req,
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"version": "2.0.0"}`)),
+			Request:    req,
+		}, nil
+	})
+	client, err := CreateClient(
+		&ClientConfig{ApiToken: "faketoken"},
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithRetryPolicy(&BackoffRetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := client.GetVersion(ctx); err != nil {
+		t.Errorf("Expected GET to succeed after retries, got %v", err)
+	}
+	if attempts[http.MethodGet] != 3 {
+		t.Errorf("Expected 3 GET attempts, got %d", attempts[http.MethodGet])
+	}
+
+	_, err = client.CreateTerminal(ctx)
+	if !hasStatusCode(err, http.StatusServiceUnavailable) {
+		t.Errorf("Expected POST to fail without retrying, got %v", err)
+	}
+	if attempts[http.MethodPost] != 1 {
+		t.Errorf("Expected 1 POST attempt, got %d", attempts[http.MethodPost])
+	}
+
+	policy := DefaultRetryPolicy()
+	req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	for retryAfter, expected := range map[string]bool{"2": true, "3600": false} {
+		resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {retryAfter}}}
+		delay, retry := policy.Retry(req, resp, nil, 1)
+		if retry != expected || retry && delay != 2*time.Second {
+			t.Errorf("Expected Retry-After %s to retry %t with MaxBackoff %s, got %t after %s", retryAfter, expected, policy.MaxBackoff, retry, delay)
+		}
+	}
+}
+
+func TestWaitUntilReady(t *testing.T) {
+	attempts := 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"connections": 0, "kernels": 0}`)),
+			Request:    req,
+		}, nil
+	})
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"}, WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.WaitUntilReady(ctx); err != nil {
+		t.Errorf("Expected server to become ready, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 status polls, got %d", attempts)
+	}
+}
+
+func TestCookieAuthLogin(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			http.SetCookie(w, &http.Cookie{Name: "_xsrf", Value: "xsrf-value", Path: "/"})
+			return
+		}
+		if r.FormValue("_xsrf") != "xsrf-value" || r.FormValue("password") != "secret" {
+			// jupyter_server renders the login form again with a 401
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`<form action="/login" method="post"><input type="password" name="password"></form>`))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "username-session", Value: "logged-in", Path: "/"})
+		http.Redirect(w, r, "/lab", http.StatusFound)
+	})
+	mux.HandleFunc("/api/terminals", func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie("username-session")
+		if err != nil || session.Value != "logged-in" || r.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("X-XSRFToken") != "xsrf-value" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message": "'_xsrf' argument missing from POST"}`))
+			return
+		}
+		w.Write([]byte(`{"name": "1"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	httpClient := &http.Client{}
+	// the jar must survive an http client set after WithCookieAuth
+	for _, options := range [][]ClientOption{
+		{WithURL(server.URL), WithCookieAuth(nil)},
+		{WithURL(server.URL), WithCookieAuth(nil), WithHTTPClient(httpClient)},
+	} {
+		client, err := CreateClient(&ClientConfig{}, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+		if err := client.Login(ctx, "wrong"); !errors.Is(err, ErrInvalidPassword) {
+			t.Errorf("Expected invalid password error, got %v", err)
+		}
+		if err := client.Login(ctx, "secret"); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := client.CreateTerminal(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.Name != "1" {
+			t.Errorf("Expected terminal name 1, got %s", data.Name)
+		}
+	}
+	if httpClient.Jar != nil {
+		t.Errorf("Expected the jar to be installed on a copy of the http client")
+	}
+}
+
+func TestTokenFileAuthenticator(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("old-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := NewTokenFileAuthenticator(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var authorizations []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		authorizations = append(authorizations, req.Header.Get("Authorization"))
+		if req.Header.Get("Authorization") != "Bearer new-token" {
+			return &http.Response{StatusCode: http.StatusForbidden, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"version": "2.0.0"}`)), Request: req}, nil
+	})
+	client, err := CreateClient(&ClientConfig{}, WithAuthenticator(authenticator), WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// same size as the old token so a stale cached value relies on Refresh
+	if err := os.WriteFile(tokenFile, []byte("new-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := client.GetVersion(ctx); err != nil {
+		t.Fatalf("Expected request with rotated token to succeed, got %v", err)
+	}
+	if authorizations[len(authorizations)-1] != "Bearer new-token" {
+		t.Errorf("Expected rotated token to be sent, got %v", authorizations)
+	}
+}
+
+func TestDiscoverServers(t *testing.T) {
+	runtimeDir := t.TempDir()
+	t.Setenv("JUPYTER_RUNTIME_DIR", runtimeDir)
+
+	running := `{"url": "http://localhost:8899/lab/", "base_url": "/lab/", "token": "discovered", "pid": ` + strconv.Itoa(os.Getpid()) + `, "root_dir": "/home/jupyter"}`
+	stopped := `{"url": "http://localhost:8898/", "base_url": "/", "token": "stale", "pid": 999999999}`
+	if err := os.WriteFile(filepath.Join(runtimeDir, "jpserver-1.json"), []byte(running), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(runtimeDir, "jpserver-2.json"), []byte(stopped), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := DiscoverServers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].Token != "discovered" {
+		t.Fatalf("Expected only the running server to be discovered, got %v", servers)
+	}
+
+	client, err := CreateClientFromServerInfo(&servers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.ApiURL != "http://localhost:8899/lab/api" || client.ApiToken != "discovered" {
+		t.Errorf("Expected client for discovered server, got %s with token %s", client.ApiURL, client.ApiToken)
+	}
+}
+
 func TestGetStatus(t *testing.T) {
 	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
 	if err != nil {
@@ -40,10 +362,19 @@ func TestGetMe(t *testing.T) {
 		t.Error(err)
 	}
 	ctx := context.Background()
-	_, err = client.GetMe(ctx)
+	data, err := client.GetMe(ctx, &GetMeParams{Permissions: Permissions{"contents": {"read", "write"}}})
 	if err != nil {
 		t.Error(err)
 	}
+	if data.Identity.Username == "" {
+		t.Errorf("Expected identity to have a username")
+	}
+	if !data.Can("contents", "read") || !data.Can("contents", "write") {
+		t.Errorf("Expected token to have contents read and write permissions, got %v", data.Permissions)
+	}
+	if data.Can("kernels", "execute") {
+		t.Errorf("Expected unrequested permissions to be absent, got %v", data.Permissions)
+	}
 }
 
 func TestGetContents(t *testing.T) {
@@ -61,6 +392,29 @@ func TestGetContents(t *testing.T) {
 	}
 }
 
+func TestGetContentsNotFound(t *testing.T) {
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	_, err = client.GetContents(ctx, "does-not-exist.txt", nil)
+	if !IsNotFound(err) {
+		t.Errorf("Expected not found error for missing file, got %v", err)
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected error to be an *APIError, got %T", err)
+	}
+	if apiErr.Method != http.MethodGet {
+		t.Errorf("Expected error method to be GET, got %s", apiErr.Method)
+	}
+	if apiErr.Message == "" {
+		t.Errorf("Expected error message to be decoded from response body")
+	}
+}
+
 func TestCreateContents(t *testing.T) {
 	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
 	if err != nil {
@@ -114,6 +468,135 @@ func TestPutContents(t *testing.T) {
 	}
 }
 
+func TestPutGetNotebook(t *testing.T) {
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	notebook := nbformat.New()
+	notebook.Cells = append(notebook.Cells, nbformat.Cell{Id: "cell-1", CellType: nbformat.CellTypeCode, Source: "print('hello')"})
+	data, err := client.PutNotebook(ctx, "hello.ipynb", notebook)
+	if err != nil {
+		t.Error(err)
+	}
+	if data.Type != "notebook" {
+		t.Errorf("Expected saved content to have type notebook, got %s", data.Type)
+	}
+
+	getData, err := client.GetNotebook(ctx, "hello.ipynb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(getData.Cells) != 1 || getData.Cells[0].Source != "print('hello')" {
+		t.Errorf("Expected notebook to contain saved code cell, got %v", getData.Cells)
+	}
+}
+
+func TestGetContentsFormats(t *testing.T) {
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	_, err = client.PutContents(ctx, "formats.txt", &PutContentsBody{Content: "hello world", Format: "text", Type: "file"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	textData, err := client.GetContents(ctx, "formats.txt", &GetContentsParams{Format: "text", Content: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if textData.Text() != "hello world" {
+		t.Errorf("Expected text content hello world, got %q", textData.Text())
+	}
+
+	base64Data, err := client.GetContents(ctx, "formats.txt", &GetContentsParams{Format: "base64", Content: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(base64Data.Bytes()) != "hello world" {
+		t.Errorf("Expected base64 content to decode to hello world, got %q", base64Data.Bytes())
+	}
+
+	dirData, err := client.GetContents(ctx, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, child := range dirData.Children() {
+		if child.Name == "formats.txt" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected formats.txt in root directory listing")
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	payload := strings.Repeat("0123456789", 1000)
+	var progress []int64
+	data, err := client.UploadFile(ctx, "upload.txt", strings.NewReader(payload), &UploadFileOptions{
+		ChunkSize: 4096,
+		Progress:  func(uploaded int64) { progress = append(progress, uploaded) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Size != len(payload) {
+		t.Errorf("Expected uploaded file size %d, got %d", len(payload), data.Size)
+	}
+	if len(progress) != 3 || progress[2] != int64(len(payload)) {
+		t.Errorf("Expected 3 progress callbacks ending at %d, got %v", len(payload), progress)
+	}
+
+	getData, err := client.GetContents(ctx, "upload.txt", &GetContentsParams{Format: "text", Content: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getData.Text() != payload {
+		t.Errorf("Expected uploaded file contents to match payload")
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	payload := "\x00\x01binary\xff"
+	_, err = client.UploadFile(ctx, "download.bin", strings.NewReader(payload), nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, options := range []*DownloadFileOptions{nil, {Raw: true}} {
+		reader, content, err := client.DownloadFile(ctx, "download.bin", options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Error(err)
+		}
+		if string(data) != payload {
+			t.Errorf("Expected downloaded file to match payload, got %q", data)
+		}
+		if content.Name != "download.bin" {
+			t.Errorf("Expected downloaded content name download.bin, got %s", content.Name)
+		}
+	}
+}
+
 func TestCreateDeleteContents(t *testing.T) {
 	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
 	if err != nil {
@@ -134,19 +617,65 @@ func TestCreateDeleteContents(t *testing.T) {
 	}
 }
 
+func TestCreateListRestoreDeleteCheckpoints(t *testing.T) {
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	_, err = client.PutContents(ctx, "checkpoint.txt", &PutContentsBody{Content: "original", Format: "text", Type: "file"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	createData, err := client.CreateCheckpoint(ctx, "checkpoint.txt")
+	if err != nil {
+		t.Error(err)
+	}
+	id := createData.Id
+
+	listData, err := client.ListCheckpoints(ctx, "checkpoint.txt")
+	if err != nil {
+		t.Error(err)
+	}
+	found := false
+	for _, checkpoint := range *listData {
+		if checkpoint.Id == id {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Checkpoint %s not found in list", id)
+	}
+
+	_, err = client.PutContents(ctx, "checkpoint.txt", &PutContentsBody{Content: "modified", Format: "text", Type: "file"})
+	if err != nil {
+		t.Error(err)
+	}
+	err = client.RestoreCheckpoint(ctx, "checkpoint.txt", id)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = client.DeleteCheckpoint(ctx, "checkpoint.txt", id)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 func TestCreateListGetDeleteSessions(t *testing.T) {
 	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
 	if err != nil {
 		t.Error(err)
 	}
 	ctx := context.Background()
-	id := "fe03e6be-47e0-407d-8c3f-46acc6b18d9d"
-	createData, err := client.CreateSession(ctx, &Session{Id: id, Kernel: map[string]string{"name": "python3"}})
+	createData, err := client.CreateSession(ctx, &CreateSessionBody{Path: "session.ipynb", Type: "notebook", Kernel: SessionKernel{Name: "python3"}})
 	if err != nil {
 		t.Error(err)
 	}
-	if createData.Id != id {
-		t.Errorf("Expected created session to have id %s", id)
+	id := createData.Id
+	if createData.Kernel.Id == "" || createData.Kernel.Name != "python3" {
+		t.Errorf("Expected created session to have a python3 kernel, got %v", createData.Kernel)
 	}
 
 	listData, err := client.GetSessions(ctx)
@@ -172,6 +701,14 @@ func TestCreateListGetDeleteSessions(t *testing.T) {
 		t.Errorf("Session %s not found", id)
 	}
 
+	findData, err := client.FindSessionByPath(ctx, "session.ipynb")
+	if err != nil {
+		t.Error(err)
+	}
+	if findData == nil || findData.Id != id {
+		t.Errorf("Expected session %s to be found by path, got %v", id, findData)
+	}
+
 	err = client.DeleteSession(ctx, id)
 	if err != nil {
 		t.Error(err)
@@ -193,6 +730,38 @@ func TestGetKernelSpecs(t *testing.T) {
 	}
 }
 
+func TestGetKernelSpecAndResource(t *testing.T) {
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	specs, err := client.GetKernelSpecs(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	python := specs.ByLanguage("python")
+	if len(python) == 0 || python[0].Name != "python3" {
+		t.Errorf("Expected python3 kernelspec for language python, got %v", python)
+	}
+
+	data, err := client.GetKernelSpec(ctx, "python3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Spec.Language != "python" || len(data.Spec.Argv) == 0 {
+		t.Errorf("Expected python kernelspec with argv, got %v", data.Spec)
+	}
+
+	logo, err := client.GetKernelSpecResource(ctx, "python3", "logo-64x64.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(logo, []byte("\x89PNG")) {
+		t.Errorf("Expected kernelspec logo to be a png")
+	}
+}
+
 func TestCreateListGetDeleteKernels(t *testing.T) {
 	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
 	if err != nil {
@@ -234,6 +803,35 @@ func TestCreateListGetDeleteKernels(t *testing.T) {
 	}
 }
 
+func TestGetPatchConfigSection(t *testing.T) {
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	patchData, err := client.PatchConfigSection(ctx, "gotest", ConfigSection{"nested": map[string]interface{}{"key": "value"}})
+	if err != nil {
+		t.Error(err)
+	}
+	if _, ok := (*patchData)["nested"]; !ok {
+		t.Errorf("Expected patched config section to contain key nested, got %v", *patchData)
+	}
+
+	getData, err := client.GetConfigSection(ctx, "gotest")
+	if err != nil {
+		t.Error(err)
+	}
+	nested, ok := (*getData)["nested"].(map[string]interface{})
+	if !ok || nested["key"] != "value" {
+		t.Errorf("Expected config section nested.key to be value, got %v", *getData)
+	}
+
+	_, err = client.PatchConfigSection(ctx, "gotest", ConfigSection{"nested": nil})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 func TestCreateListGetDeleteTerminals(t *testing.T) {
 	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
 	if err != nil {
@@ -274,3 +872,193 @@ func TestCreateListGetDeleteTerminals(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestConnectKernelExecute(t *testing.T) {
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	createData, err := client.CreateKernel(ctx, CreateKernelBody{Name: "python3"})
+	if err != nil {
+		t.Error(err)
+	}
+	defer client.DeleteKernel(ctx, createData.Id)
+
+	kernel, err := client.ConnectKernel(ctx, createData.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kernel.Close()
+
+	result, err := kernel.Execute(ctx, "print('hello world')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reply.Status != "ok" {
+		t.Errorf("Expected execute_reply status ok, got %s", result.Reply.Status)
+	}
+
+	found := false
+	for _, msg := range result.IOPub {
+		if msg.Header.MsgType == "stream" {
+			var stream StreamContent
+			if err := json.Unmarshal(msg.Content, &stream); err != nil {
+				t.Error(err)
+			}
+			if stream.Text == "hello world\n" {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected stream output 'hello world' in iopub messages")
+	}
+}
+
+func TestConnectTerminal(t *testing.T) {
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	createData, err := client.CreateTerminal(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	defer client.DeleteTerminal(ctx, createData.Name)
+
+	terminal, err := client.ConnectTerminal(ctx, createData.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer terminal.Close()
+
+	if err := terminal.Resize(24, 80); err != nil {
+		t.Error(err)
+	}
+	if _, err := terminal.Write([]byte("echo hello-$((40+2))\r")); err != nil {
+		t.Error(err)
+	}
+
+	output := ""
+	buf := make([]byte, 1024)
+	for !strings.Contains(output, "hello-42") {
+		n, err := terminal.Read(buf)
+		if err != nil {
+			t.Fatalf("Expected terminal output to contain hello-42, got %q: %v", output, err)
+		}
+		output += string(buf[:n])
+	}
+}
+
+func TestSyncUpload(t *testing.T) {
+	client, err := CreateClient(&ClientConfig{ApiToken: "faketoken"})
+	if err != nil {
+		t.Error(err)
+	}
+	ctx := context.Background()
+	localDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(localDir, "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.txt": "a", "nested/b.txt": "b", "skip.log": "log"} {
+		if err := os.WriteFile(filepath.Join(localDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	options := &SyncOptions{Direction: SyncUpload, DryRun: true, Exclude: []string{"*.log"}}
+	plan, err := client.Sync(ctx, localDir, "synctest", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 3 {
+		t.Errorf("Expected dry run plan with 3 actions, got:\n%s", plan)
+	}
+	if _, err := client.GetContents(ctx, "synctest", nil); !IsNotFound(err) {
+		t.Errorf("Expected dry run to leave server unchanged, got %v", err)
+	}
+
+	options.DryRun = false
+	_, err = client.Sync(ctx, localDir, "synctest", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := client.GetContents(ctx, "synctest/nested/b.txt", &GetContentsParams{Format: "text", Content: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Text() != "b" {
+		t.Errorf("Expected synced file contents b, got %q", data.Text())
+	}
+
+	plan, err = client.Sync(ctx, localDir, "synctest", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 0 {
+		t.Errorf("Expected converged directories to produce no actions, got:\n%s", plan)
+	}
+}
+
+func TestCollectOutputs(t *testing.T) {
+	message := func(msgType string, content string) *KernelMessage {
+		return &KernelMessage{Channel: "iopub", Header: KernelMessageHeader{MsgType: msgType}, Content: json.RawMessage(content)}
+	}
+	messages := []*KernelMessage{
+		message("status", `{"execution_state": "busy"}`),
+		message("execute_input", `{"code": "run()", "execution_count": 3}`),
+		message("stream", `{"name": "stdout", "text": "progress 10%\r"}`),
+		message("stream", `{"name": "stdout", "text": "progress 100%\ndone\n"}`),
+		message("stream", `{"name": "stderr", "text": "warning\n"}`),
+		message("stream", `{"name": "stdout", "text": "abc\b\bd\n"}`),
+		message("display_data", `{"data": {"text/plain": "0%"}, "metadata": {}, "transient": {"display_id": "bar"}}`),
+		message("update_display_data", `{"data": {"text/plain": "100%"}, "metadata": {}, "transient": {"display_id": "bar"}}`),
+		message("execute_result", `{"data": {"text/plain": "42"}, "metadata": {}, "execution_count": 3}`),
+		message("status", `{"execution_state": "idle"}`),
+	}
+	outputs, err := CollectOutputs(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 5 {
+		t.Fatalf("Expected 5 outputs, got %d: %v", len(outputs), outputs)
+	}
+	if outputs[0].Name != "stdout" || outputs[0].Text != "progress 100%\ndone\n" {
+		t.Errorf("Expected merged stdout with carriage return applied, got %q", outputs[0].Text)
+	}
+	if outputs[1].Name != "stderr" || outputs[2].Text != "ad\n" {
+		t.Errorf("Expected stderr then a new stdout output with backspaces applied, got %v", outputs[1:3])
+	}
+	if string(outputs[3].Data["text/plain"]) != `"100%"` {
+		t.Errorf("Expected display to be updated by display_id, got %s", outputs[3].Data["text/plain"])
+	}
+	if outputs[4].OutputType != "execute_result" || outputs[4].ExecutionCount == nil || *outputs[4].ExecutionCount != 3 {
+		t.Errorf("Expected execute_result with execution count 3, got %v", outputs[4])
+	}
+
+	cleared, err := CollectOutputs([]*KernelMessage{
+		message("stream", `{"name": "stdout", "text": "frame 1\n"}`),
+		message("clear_output", `{"wait": true}`),
+		message("stream", `{"name": "stdout", "text": "frame 2\n"}`),
+		message("clear_output", `{"wait": true}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cleared) != 1 || cleared[0].Text != "frame 2\n" {
+		t.Errorf("Expected clear_output wait to keep only the last frame, got %v", cleared)
+	}
+
+	cleared, err = CollectOutputs([]*KernelMessage{
+		message("stream", `{"name": "stdout", "text": "frame 1\n"}`),
+		message("clear_output", `{"wait": false}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cleared) != 0 {
+		t.Errorf("Expected clear_output to clear immediately, got %v", cleared)
+	}
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const xsrfCookieName = "_xsrf"
+
+var ErrInvalidPassword = errors.New("login failed: invalid password")
+
+// WithCookieAuth authenticates with cookies instead of a token, as used by
+// servers with password login or behind the JupyterHub OAuth proxy. When jar
+// is nil an empty jar is created, call Login to populate it with a password.
+func WithCookieAuth(jar http.CookieJar) ClientOption {
+	return func(c *ClientConfig) error {
+		if jar == nil {
+			var err error
+			jar, err = cookiejar.New(nil)
+			if err != nil {
+				return err
+			}
+		}
+		c.cookieJar = jar
+		return nil
+	}
+}
+
+// Login posts password to the /login form storing the resulting session
+// and _xsrf cookies in the cookie jar set by WithCookieAuth.
+func (c *ClientConfig) Login(ctx context.Context, password string) error {
+	client := *c.httpClient()
+	if client.Jar == nil {
+		return errors.New("login requires a cookie jar, create the client with WithCookieAuth")
+	}
+	// a successful login redirects while a failed one renders the form again,
+	// with a 401 status on jupyter_server
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	loginURL := fmt.Sprintf("%s/login", c.serverURL())
+
+	// fetching the form sets the _xsrf cookie the post must echo back
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, loginURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	form := url.Values{}
+	form.Set("password", password)
+	xsrf := c.xsrfToken(req.URL)
+	if xsrf != "" {
+		form.Set(xsrfCookieName, xsrf)
+	}
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, loginURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if xsrf != "" {
+		req.Header.Set("X-XSRFToken", xsrf)
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		return nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300, resp.StatusCode == http.StatusUnauthorized:
+		return ErrInvalidPassword
+	}
+	return newAPIError(resp, body)
+}
+
+func (c *ClientConfig) xsrfToken(u *url.URL) string {
+	jar := c.httpClient().Jar
+	if jar == nil {
+		return ""
+	}
+	for _, cookie := range jar.Cookies(u) {
+		if cookie.Name == xsrfCookieName {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// setAuthHeaders applies the authenticator, defaulting to the api token, and
+// for methods that modify state the X-XSRFToken header matching the _xsrf
+// cookie.
+func (c *ClientConfig) setAuthHeaders(req *http.Request) error {
+	if c.Authenticator != nil {
+		if err := c.Authenticator.Apply(req); err != nil {
+			return err
+		}
+	} else if c.ApiToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.ApiToken))
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	if xsrf := c.xsrfToken(req.URL); xsrf != "" {
+		req.Header.Set("X-XSRFToken", xsrf)
+	}
+	return nil
+}
+
+// Authenticator adds credentials to each outgoing request, including the
+// handshake of kernel and terminal websockets.
+type Authenticator interface {
+	Apply(req *http.Request) error
+}
+
+// Refresher is optionally implemented by an Authenticator whose credentials
+// can be renewed. It is called once after a 401 or 403 response and the
+// request is then sent again.
+type Refresher interface {
+	Refresh(ctx context.Context) error
+}
+
+func WithAuthenticator(authenticator Authenticator) ClientOption {
+	return func(c *ClientConfig) error {
+		c.Authenticator = authenticator
+		return nil
+	}
+}
+
+// TokenAuthenticator sends a static jupyter server token.
+type TokenAuthenticator struct {
+	Token string
+}
+
+func (a *TokenAuthenticator) Apply(req *http.Request) error {
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.Token))
+	return nil
+}
+
+// HubTokenAuthenticator sends a JupyterHub api token using the token scheme
+// expected by the hub and single-user servers.
+type HubTokenAuthenticator struct {
+	Token string
+}
+
+func (a *HubTokenAuthenticator) Apply(req *http.Request) error {
+	req.Header.Set("Authorization", fmt.Sprintf("token %s", a.Token))
+	return nil
+}
+
+// HeaderAuthenticator sets arbitrary headers, for example those expected by
+// an authenticating proxy in front of the server.
+type HeaderAuthenticator struct {
+	Header http.Header
+}
+
+func (a *HeaderAuthenticator) Apply(req *http.Request) error {
+	for name, values := range a.Header {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	return nil
+}
+
+// TokenFileAuthenticator reads the token from a file and reads it again
+// whenever the file changes, such as a rotated kubernetes secret mount.
+type TokenFileAuthenticator struct {
+	Path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+func NewTokenFileAuthenticator(path string) (*TokenFileAuthenticator, error) {
+	a := &TokenFileAuthenticator{Path: path}
+	if _, err := a.currentToken(false); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *TokenFileAuthenticator) currentToken(force bool) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stat, err := os.Stat(a.Path)
+	if err != nil {
+		return "", err
+	}
+	if !force && a.token != "" && stat.ModTime().Equal(a.modTime) && stat.Size() == a.size {
+		return a.token, nil
+	}
+
+	data, err := os.ReadFile(a.Path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", a.Path)
+	}
+	a.token, a.modTime, a.size = token, stat.ModTime(), stat.Size()
+	return a.token, nil
+}
+
+func (a *TokenFileAuthenticator) Apply(req *http.Request) error {
+	token, err := a.currentToken(false)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return nil
+}
+
+func (a *TokenFileAuthenticator) Refresh(ctx context.Context) error {
+	_, err := a.currentToken(true)
+	return err
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const defaultServerURL = "http://localhost:8888"
+
+// discoverApiURL resolves the api url from the WithURL and WithBaseURL
+// options, falling back to JUPYTER_SERVER_URL and then the variables set by
+// JupyterHub inside a single-user server.
+func discoverApiURL(url string, baseURL string) string {
+	if url == "" {
+		url = os.Getenv("JUPYTER_SERVER_URL")
+	}
+	if _, ok := os.LookupEnv("JUPYTERHUB_API_URL"); ok {
+		if url == "" {
+			// the service url is the bind address of the single-user server
+			url = strings.Replace(os.Getenv("JUPYTERHUB_SERVICE_URL"), "://0.0.0.0", "://127.0.0.1", 1)
+		}
+		if baseURL == "" {
+			baseURL = os.Getenv("JUPYTERHUB_SERVICE_PREFIX")
+		}
+	}
+	if url == "" {
+		url = defaultServerURL
+	}
+	return joinBaseURL(url, baseURL) + "/api"
+}
+
+func joinBaseURL(url string, baseURL string) string {
+	url = strings.TrimSuffix(url, "/")
+	baseURL = strings.Trim(baseURL, "/")
+	if baseURL == "" || strings.HasSuffix(url, "/"+baseURL) {
+		return url
+	}
+	return url + "/" + baseURL
+}
+
+func discoverApiToken() (string, bool) {
+	for _, name := range []string{"JUPYTERLAB_API_TOKEN", "JUPYTER_TOKEN", "JPY_API_TOKEN", "JUPYTERHUB_API_TOKEN"} {
+		if token := os.Getenv(name); token != "" {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// RuntimeDir returns the directory jupyter writes jpserver-*.json files to,
+// following the lookup order of jupyter_core.
+func RuntimeDir() (string, error) {
+	if dir := os.Getenv("JUPYTER_RUNTIME_DIR"); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("JUPYTER_DATA_DIR"); dir != "" {
+		return filepath.Join(dir, "runtime"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "Jupyter", "runtime"), nil
+	case "windows":
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "jupyter", "runtime"), nil
+		}
+		return filepath.Join(home, ".jupyter", "runtime"), nil
+	}
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "jupyter", "runtime"), nil
+	}
+	return filepath.Join(home, ".local", "share", "jupyter", "runtime"), nil
+}
+
+// DiscoverServers lists the servers described in the runtime directory whose
+// process is still running, most recently started first.
+func DiscoverServers() ([]ServerInfo, error) {
+	dir, err := RuntimeDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "jpserver-*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	type discovered struct {
+		info    ServerInfo
+		modTime int64
+	}
+	var found []discovered
+	for _, file := range files {
+		stat, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var info ServerInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			continue
+		}
+		if info.Pid != 0 && !processAlive(info.Pid) {
+			continue
+		}
+		found = append(found, discovered{info: info, modTime: stat.ModTime().UnixNano()})
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].modTime > found[j].modTime
+	})
+	servers := make([]ServerInfo, 0, len(found))
+	for _, server := range found {
+		servers = append(servers, server.info)
+	}
+	return servers, nil
+}
+
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// FindProcess only succeeds for running processes on windows
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func CreateClientFromServerInfo(info *ServerInfo, options ...ClientOption) (*ClientConfig, error) {
+	options = append([]ClientOption{WithURL(info.URL), WithBaseURL(info.BaseURL)}, options...)
+	return CreateClient(&ClientConfig{ApiToken: info.Token}, options...)
+}
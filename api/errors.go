@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// APIError is returned for any response with a non 2XX status code. Jupyter
+// server handlers reply with a JSON body containing message, reason and
+// traceback which are decoded when present.
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Method     string `json:"-"`
+	URL        string `json:"-"`
+	Message    string `json:"message"`
+	Reason     string `json:"reason"`
+	Traceback  string `json:"traceback"`
+	Body       []byte `json:"-"`
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := APIError{
+		StatusCode: resp.StatusCode,
+		Body:       body,
+	}
+	if resp.Request != nil {
+		apiErr.Method = resp.Request.Method
+		apiErr.URL = resp.Request.URL.String()
+	}
+	// the body is not guaranteed to be json e.g. proxies in front of the server
+	_ = json.Unmarshal(body, &apiErr)
+	return &apiErr
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s returned status code of %d instead of 2XX", e.Method, e.URL, e.StatusCode)
+	if e.Message != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Message)
+	} else if e.Reason != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Reason)
+	}
+	return msg
+}
+
+func hasStatusCode(err error, statusCode int) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == statusCode
+	}
+	return false
+}
+
+func IsBadRequest(err error) bool {
+	return hasStatusCode(err, http.StatusBadRequest)
+}
+
+func IsUnauthorized(err error) bool {
+	return hasStatusCode(err, http.StatusUnauthorized)
+}
+
+func IsForbidden(err error) bool {
+	return hasStatusCode(err, http.StatusForbidden)
+}
+
+func IsNotFound(err error) bool {
+	return hasStatusCode(err, http.StatusNotFound)
+}
+
+func IsConflict(err error) bool {
+	return hasStatusCode(err, http.StatusConflict)
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/costrouc/go-jupyterlab-api/nbformat"
+)
+
+type ExecuteNotebookOptions struct {
+	// OutputPath receives the executed notebook, the input is overwritten
+	// when empty
+	OutputPath string
+	// KernelName overrides the kernelspec in the notebook metadata
+	KernelName string
+	// AllowErrors keeps executing after a cell fails. Cells tagged
+	// raises-exception may always fail.
+	AllowErrors bool
+	// CellTimeout interrupts the kernel when a cell runs longer, zero means
+	// no limit
+	CellTimeout time.Duration
+}
+
+// CellExecutionError is returned by ExecuteNotebook when a cell fails and
+// errors are not allowed.
+type CellExecutionError struct {
+	// Index of the cell in the notebook
+	Index     int
+	Ename     string
+	Evalue    string
+	Traceback []string
+}
+
+func (e *CellExecutionError) Error() string {
+	return fmt.Sprintf("cell %d raised %s: %s", e.Index, e.Ename, e.Evalue)
+}
+
+// ExecuteNotebook runs the code cells of the notebook at path in order in a
+// new session and saves the outputs and execution counts. Outputs of earlier
+// runs are cleared first. When a cell fails the notebook is saved up to that
+// cell and a *CellExecutionError returned.
+func (c *ClientConfig) ExecuteNotebook(ctx context.Context, notebookPath string, options *ExecuteNotebookOptions) (*nbformat.Notebook, error) {
+	if options == nil {
+		options = &ExecuteNotebookOptions{}
+	}
+	outputPath := options.OutputPath
+	if outputPath == "" {
+		outputPath = notebookPath
+	}
+
+	notebook, err := c.GetNotebook(ctx, notebookPath)
+	if err != nil {
+		return nil, err
+	}
+	kernelName := options.KernelName
+	if kernelName == "" && notebook.Metadata.Kernelspec != nil {
+		kernelName = notebook.Metadata.Kernelspec.Name
+	}
+
+	// the server hands out the existing session of a path, which would run
+	// the cells in a kernel someone else is using
+	existing, err := c.FindSessionByPath(ctx, outputPath)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("notebook %s already has session %s", outputPath, existing.Id)
+	}
+	session, err := c.CreateSession(ctx, &CreateSessionBody{
+		Path:   outputPath,
+		Name:   path.Base(outputPath),
+		Type:   "notebook",
+		Kernel: SessionKernel{Name: kernelName},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer c.DeleteSession(context.WithoutCancel(ctx), session.Id)
+
+	conn, err := c.ConnectKernel(ctx, session.Kernel.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	info, err := conn.KernelInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(info.LanguageInfo); err == nil {
+		var languageInfo nbformat.LanguageInfoMetadata
+		if err := json.Unmarshal(data, &languageInfo); err == nil && languageInfo.Name != "" {
+			notebook.Metadata.LanguageInfo = &languageInfo
+		}
+	}
+
+	// outputs of a previous run must not survive in skipped cells or cells
+	// after a failure
+	for i := range notebook.Cells {
+		if cell := &notebook.Cells[i]; cell.CellType == nbformat.CellTypeCode {
+			cell.ExecutionCount = nil
+			cell.Outputs = nil
+		}
+	}
+	for i := range notebook.Cells {
+		cell := &notebook.Cells[i]
+		if cell.CellType != nbformat.CellTypeCode || strings.TrimSpace(string(cell.Source)) == "" {
+			continue
+		}
+
+		result, err := c.executeCell(ctx, conn, session.Kernel.Id, string(cell.Source), options)
+		if err != nil {
+			return notebook, c.saveExecutedNotebook(ctx, outputPath, notebook, fmt.Errorf("cell %d: %w", i, err))
+		}
+		outputs, err := result.Outputs()
+		if err != nil {
+			return notebook, c.saveExecutedNotebook(ctx, outputPath, notebook, fmt.Errorf("cell %d: %w", i, err))
+		}
+		executionCount := result.Reply.ExecutionCount
+		cell.ExecutionCount = &executionCount
+		cell.Outputs = outputs
+
+		if result.Reply.Status == "error" && !options.AllowErrors && !cellRaisesException(cell) {
+			return notebook, c.saveExecutedNotebook(ctx, outputPath, notebook, &CellExecutionError{
+				Index:     i,
+				Ename:     result.Reply.Ename,
+				Evalue:    result.Reply.Evalue,
+				Traceback: result.Reply.Traceback,
+			})
+		}
+	}
+	return notebook, c.saveExecutedNotebook(ctx, outputPath, notebook, nil)
+}
+
+func (c *ClientConfig) executeCell(ctx context.Context, conn *KernelConnection, kernel string, code string, options *ExecuteNotebookOptions) (*ExecuteResult, error) {
+	cellCtx := ctx
+	if options.CellTimeout > 0 {
+		var cancel context.CancelFunc
+		cellCtx, cancel = context.WithTimeout(ctx, options.CellTimeout)
+		defer cancel()
+	}
+
+	result, err := conn.ExecuteRequest(cellCtx, &ExecuteRequestContent{
+		Code:            code,
+		StoreHistory:    true,
+		UserExpressions: map[string]string{},
+		StopOnError:     !options.AllowErrors,
+	})
+	if err != nil && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		_ = c.InterruptKernel(ctx, kernel)
+		return nil, fmt.Errorf("timed out after %s: %w", options.CellTimeout, err)
+	}
+	return result, err
+}
+
+// saveExecutedNotebook saves the notebook and returns executionErr unless
+// saving failed.
+func (c *ClientConfig) saveExecutedNotebook(ctx context.Context, outputPath string, notebook *nbformat.Notebook, executionErr error) error {
+	if _, err := c.PutNotebook(context.WithoutCancel(ctx), outputPath, notebook); err != nil {
+		if executionErr != nil {
+			return fmt.Errorf("%w (saving %s failed: %v)", executionErr, outputPath, err)
+		}
+		return err
+	}
+	return executionErr
+}
+
+func cellRaisesException(cell *nbformat.Cell) bool {
+	var tags []string
+	if err := json.Unmarshal(cell.Metadata["tags"], &tags); err != nil {
+		return false
+	}
+	for _, tag := range tags {
+		if tag == "raises-exception" {
+			return true
+		}
+	}
+	return false
+}
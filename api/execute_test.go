@@ -0,0 +1,99 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/costrouc/go-jupyterlab-api/api"
+	"github.com/costrouc/go-jupyterlab-api/jupytertest"
+	"github.com/costrouc/go-jupyterlab-api/nbformat"
+)
+
+func TestExecuteNotebook(t *testing.T) {
+	server := jupytertest.NewServer()
+	t.Cleanup(server.Close)
+	client, err := server.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Execute = func(code string) []jupytertest.KernelOutput {
+		switch code {
+		case "print('hello')":
+			return []jupytertest.KernelOutput{jupytertest.Stream("stdout", "hel"), jupytertest.Stream("stdout", "lo\n")}
+		case "1 / 0":
+			return []jupytertest.KernelOutput{jupytertest.Error("ZeroDivisionError", "division by zero")}
+		case "1 + 1":
+			return []jupytertest.KernelOutput{jupytertest.ExecuteResult(map[string]interface{}{"text/plain": "2"})}
+		}
+		return nil
+	}
+	ctx := context.Background()
+
+	notebook := nbformat.New()
+	notebook.Metadata.Kernelspec = &nbformat.KernelspecMetadata{Name: jupytertest.DefaultKernelSpec, DisplayName: "Python 3 (ipykernel)"}
+	for _, source := range []string{"print('hello')", "", "1 / 0", "1 + 1"} {
+		notebook.Cells = append(notebook.Cells, nbformat.Cell{CellType: nbformat.CellTypeCode, Source: nbformat.MultilineString(source), Metadata: nbformat.Metadata{}})
+	}
+	notebook.Cells = append(notebook.Cells, nbformat.Cell{CellType: nbformat.CellTypeMarkdown, Source: "# report", Metadata: nbformat.Metadata{}})
+	// outputs of an earlier run in a skipped cell and a cell after the failure
+	staleCount := 7
+	for _, i := range []int{1, 3} {
+		notebook.Cells[i].ExecutionCount = &staleCount
+		notebook.Cells[i].Outputs = []nbformat.Output{{OutputType: nbformat.OutputTypeStream, Name: "stdout", Text: "stale\n"}}
+	}
+	if _, err := client.PutNotebook(ctx, "report.ipynb", notebook); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.ExecuteNotebook(ctx, "report.ipynb", &api.ExecuteNotebookOptions{OutputPath: "report-failed.ipynb"})
+	var cellErr *api.CellExecutionError
+	if !errors.As(err, &cellErr) || cellErr.Index != 2 || cellErr.Ename != "ZeroDivisionError" {
+		t.Fatalf("Expected ZeroDivisionError in cell 2, got %v", err)
+	}
+	failed, err := client.GetNotebook(ctx, "report-failed.ipynb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed.Cells[2].Outputs) != 1 || failed.Cells[2].Outputs[0].OutputType != nbformat.OutputTypeError {
+		t.Errorf("Expected notebook saved up to the failing cell, got %v", failed.Cells)
+	}
+	for _, i := range []int{1, 3} {
+		if failed.Cells[i].ExecutionCount != nil || len(failed.Cells[i].Outputs) != 0 {
+			t.Errorf("Expected outputs of cell %d from an earlier run to be cleared, got %v", i, failed.Cells[i])
+		}
+	}
+
+	executed, err := client.ExecuteNotebook(ctx, "report.ipynb", &api.ExecuteNotebookOptions{AllowErrors: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := client.GetNotebook(ctx, "report.ipynb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, notebook := range []*nbformat.Notebook{executed, saved} {
+		cells := notebook.Cells
+		if cells[0].ExecutionCount == nil || *cells[0].ExecutionCount != 1 || len(cells[0].Outputs) != 1 || cells[0].Outputs[0].Text != "hello\n" {
+			t.Errorf("Expected merged stream output with execution count 1, got %v", cells[0])
+		}
+		if cells[1].ExecutionCount != nil || len(cells[1].Outputs) != 0 {
+			t.Errorf("Expected empty cell to be skipped and cleared, got %v", cells[1])
+		}
+		if cells[3].ExecutionCount == nil || *cells[3].ExecutionCount != 3 || len(cells[3].Outputs) != 1 || cells[3].Outputs[0].OutputType != nbformat.OutputTypeExecuteResult {
+			t.Errorf("Expected execute result after the allowed error, got %v", cells[3])
+		}
+		languageInfo := notebook.Metadata.LanguageInfo
+		if languageInfo == nil || languageInfo.Name != "python" || string(languageInfo.Extra["nbconvert_exporter"]) != `"python"` {
+			t.Errorf("Expected language info from the kernel, got %v", languageInfo)
+		}
+	}
+
+	sessions, err := client.GetSessions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*sessions) != 0 {
+		t.Errorf("Expected execution sessions to be removed, got %v", *sessions)
+	}
+}
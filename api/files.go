@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const defaultUploadChunkSize = 1024 * 1024
+
+// UploadFile streams r to path as a sequence of base64 encoded chunks so that
+// the whole file never has to be held in memory. Content that fits in a
+// single chunk is saved with a regular PutContents request.
+func (c *ClientConfig) UploadFile(ctx context.Context, path string, r io.Reader, options *UploadFileOptions) (*PutContentsResponse, error) {
+	chunkSize := defaultUploadChunkSize
+	var progress func(int64)
+	if options != nil {
+		if options.ChunkSize > 0 {
+			chunkSize = options.ChunkSize
+		}
+		progress = options.Progress
+	}
+
+	// read one chunk ahead so the final chunk can be numbered -1
+	current, err := readChunk(r, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	next, err := readChunk(r, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(next) == 0 {
+		result, err := c.PutContents(ctx, path, &PutContentsBody{
+			Content: base64.StdEncoding.EncodeToString(current),
+			Format:  "base64",
+			Type:    "file",
+		})
+		if err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(int64(len(current)))
+		}
+		return result, nil
+	}
+
+	var uploaded int64
+	for chunk := 1; ; chunk++ {
+		last := len(next) == 0
+		number := chunk
+		if last {
+			number = -1
+		}
+
+		// every chunk after the first appends so it is not safe to retry
+		chunkCtx := ctx
+		if chunk > 1 {
+			chunkCtx = withoutRetry(ctx)
+		}
+		result, err := c.PutContents(chunkCtx, path, &PutContentsBody{
+			Content: base64.StdEncoding.EncodeToString(current),
+			Format:  "base64",
+			Type:    "file",
+			Chunk:   number,
+		})
+		if err != nil {
+			return nil, err
+		}
+		uploaded += int64(len(current))
+		if progress != nil {
+			progress(uploaded)
+		}
+		if last {
+			return result, nil
+		}
+
+		current = next
+		next, err = readChunk(r, chunkSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func readChunk(r io.Reader, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// DownloadFile returns a reader for the file at path along with its model.
+// By default the file is fetched through the contents API and decoded from
+// text or base64, with Raw set the body of /files/{path} is streamed instead
+// and the returned model carries no content.
+func (c *ClientConfig) DownloadFile(ctx context.Context, path string, options *DownloadFileOptions) (io.ReadCloser, *Content, error) {
+	if options == nil || !options.Raw {
+		result, err := c.GetContents(ctx, path, &GetContentsParams{Type: "file", Content: 1})
+		if err != nil {
+			return nil, nil, err
+		}
+		return io.NopCloser(bytes.NewReader(result.Bytes())), result, nil
+	}
+
+	result, err := c.GetContents(ctx, path, &GetContentsParams{Type: "file", Content: 0})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	url := fmt.Sprintf("%s/files/%s", c.serverURL(), path)
+	resp, err := c.do(ctx, http.MethodGet, url, "application/octet-stream", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, result, nil
+}
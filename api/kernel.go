@@ -0,0 +1,427 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const kernelProtocolVersion = "5.3"
+
+var ErrKernelConnectionClosed = errors.New("kernel connection closed")
+
+// KernelConnection speaks the Jupyter messaging protocol over the
+// /api/kernels/{id}/channels websocket. Replies and iopub messages are routed
+// back to the request that caused them using the parent_header msg_id.
+type KernelConnection struct {
+	KernelId  string
+	SessionId string
+	Username  string
+
+	// StdinHandler answers input_request messages from the kernel. When nil
+	// execute requests are sent with allow_stdin set to false.
+	StdinHandler func(prompt string, password bool) (string, error)
+
+	conn    WebsocketConn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]*pendingKernelRequest
+	err     error
+	closed  chan struct{}
+}
+
+type pendingKernelRequest struct {
+	messages chan *KernelMessage
+	done     chan struct{}
+}
+
+func toWebsocketURL(url string) string {
+	if strings.HasPrefix(url, "https://") {
+		return "wss://" + strings.TrimPrefix(url, "https://")
+	}
+	return "ws://" + strings.TrimPrefix(url, "http://")
+}
+
+func (c *ClientConfig) dialWebsocket(ctx context.Context, url string) (WebsocketConn, error) {
+	// the handshake is authenticated like any other http request
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.setAuthHeaders(req); err != nil {
+		return nil, err
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	conn, resp, err := c.websocketDialer().DialContext(ctx, toWebsocketURL(url), req.Header)
+	if err != nil {
+		if resp != nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, newAPIError(resp, body)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (c *ClientConfig) ConnectKernel(ctx context.Context, kernel string) (*KernelConnection, error) {
+	sessionId := newUUID()
+	url := fmt.Sprintf("%s/kernels/%s/channels?session_id=%s", c.ApiURL, kernel, sessionId)
+	conn, err := c.dialWebsocket(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &KernelConnection{
+		KernelId:  kernel,
+		SessionId: sessionId,
+		Username:  "go-jupyterlab-api",
+		conn:      conn,
+		pending:   map[string]*pendingKernelRequest{},
+		closed:    make(chan struct{}),
+	}
+	go k.readLoop()
+	return k, nil
+}
+
+func (k *KernelConnection) Close() error {
+	k.shutdown(ErrKernelConnectionClosed)
+	k.writeMu.Lock()
+	defer k.writeMu.Unlock()
+	_ = k.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return k.conn.Close()
+}
+
+func (k *KernelConnection) closeErr() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.err
+}
+
+func (k *KernelConnection) shutdown(err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.err != nil {
+		return
+	}
+	k.err = err
+	close(k.closed)
+}
+
+// NewMessage builds a message with a fresh header for this connection's session.
+func (k *KernelConnection) NewMessage(channel string, msgType string, content interface{}) (*KernelMessage, error) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return &KernelMessage{
+		Channel: channel,
+		Header: KernelMessageHeader{
+			MsgId:    newUUID(),
+			MsgType:  msgType,
+			Username: k.Username,
+			Session:  k.SessionId,
+			Date:     time.Now().UTC().Format(time.RFC3339Nano),
+			Version:  kernelProtocolVersion,
+		},
+		Metadata: map[string]interface{}{},
+		Content:  data,
+	}, nil
+}
+
+func (k *KernelConnection) Send(msg *KernelMessage) error {
+	if msg.Metadata == nil {
+		msg.Metadata = map[string]interface{}{}
+	}
+	if len(msg.Content) == 0 {
+		msg.Content = json.RawMessage("{}")
+	}
+
+	k.writeMu.Lock()
+	defer k.writeMu.Unlock()
+	if err := k.closeErr(); err != nil {
+		return err
+	}
+	if len(msg.Buffers) > 0 {
+		data, err := serializeBinaryMessage(msg)
+		if err != nil {
+			return err
+		}
+		return k.conn.WriteMessage(websocket.BinaryMessage, data)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return k.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (k *KernelConnection) register(msgId string) *pendingKernelRequest {
+	p := &pendingKernelRequest{
+		messages: make(chan *KernelMessage, 64),
+		done:     make(chan struct{}),
+	}
+	k.mu.Lock()
+	k.pending[msgId] = p
+	k.mu.Unlock()
+	return p
+}
+
+func (k *KernelConnection) unregister(msgId string) {
+	k.mu.Lock()
+	if p, ok := k.pending[msgId]; ok {
+		close(p.done)
+		delete(k.pending, msgId)
+	}
+	k.mu.Unlock()
+}
+
+func (k *KernelConnection) readLoop() {
+	for {
+		messageType, data, err := k.conn.ReadMessage()
+		if err != nil {
+			k.shutdown(err)
+			return
+		}
+
+		var msg *KernelMessage
+		if messageType == websocket.BinaryMessage {
+			msg, err = deserializeBinaryMessage(data)
+		} else {
+			msg = &KernelMessage{}
+			err = json.Unmarshal(data, msg)
+		}
+		if err != nil {
+			continue
+		}
+
+		k.mu.Lock()
+		p, ok := k.pending[msg.ParentHeader.MsgId]
+		k.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		select {
+		case p.messages <- msg:
+		case <-p.done:
+		case <-k.closed:
+			return
+		}
+	}
+}
+
+// Request sends a message and returns the reply received on the same channel
+// along with every iopub message sharing its parent msg_id. Shell requests
+// return once both the reply and the iopub idle status have been received.
+func (k *KernelConnection) Request(ctx context.Context, msg *KernelMessage) (*KernelMessage, []*KernelMessage, error) {
+	msgId := msg.Header.MsgId
+	p := k.register(msgId)
+	defer k.unregister(msgId)
+
+	if err := k.Send(msg); err != nil {
+		return nil, nil, err
+	}
+
+	var reply *KernelMessage
+	var iopub []*KernelMessage
+	// control replies, such as shutdown, are not guaranteed an idle status
+	idle := msg.Channel == "control"
+	for reply == nil || !idle {
+		var m *KernelMessage
+		// messages routed before the connection closed, such as a shutdown
+		// reply, take priority over the close
+		select {
+		case m = <-p.messages:
+		default:
+			select {
+			case <-ctx.Done():
+				return reply, iopub, ctx.Err()
+			case <-k.closed:
+				return reply, iopub, k.closeErr()
+			case m = <-p.messages:
+			}
+		}
+
+		switch m.Channel {
+		case "iopub":
+			iopub = append(iopub, m)
+			if m.Header.MsgType == "status" {
+				var status KernelStatusContent
+				if err := json.Unmarshal(m.Content, &status); err == nil && status.ExecutionState == "idle" {
+					idle = true
+				}
+			}
+		case "stdin":
+			if err := k.handleStdin(m); err != nil {
+				return reply, iopub, err
+			}
+		case msg.Channel:
+			reply = m
+		}
+	}
+	return reply, iopub, nil
+}
+
+func (k *KernelConnection) handleStdin(msg *KernelMessage) error {
+	if msg.Header.MsgType != "input_request" || k.StdinHandler == nil {
+		return nil
+	}
+
+	var request InputRequestContent
+	if err := json.Unmarshal(msg.Content, &request); err != nil {
+		return err
+	}
+	value, err := k.StdinHandler(request.Prompt, request.Password)
+	if err != nil {
+		return err
+	}
+
+	reply, err := k.NewMessage("stdin", "input_reply", InputReplyContent{Value: value})
+	if err != nil {
+		return err
+	}
+	reply.ParentHeader = msg.Header
+	return k.Send(reply)
+}
+
+func (k *KernelConnection) KernelInfo(ctx context.Context) (*KernelInfoReplyContent, error) {
+	msg, err := k.NewMessage("shell", "kernel_info_request", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	reply, _, err := k.Request(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var result KernelInfoReplyContent
+	if err := json.Unmarshal(reply.Content, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (k *KernelConnection) Execute(ctx context.Context, code string) (*ExecuteResult, error) {
+	return k.ExecuteRequest(ctx, &ExecuteRequestContent{
+		Code:            code,
+		StoreHistory:    true,
+		UserExpressions: map[string]string{},
+		AllowStdin:      k.StdinHandler != nil,
+		StopOnError:     true,
+	})
+}
+
+func (k *KernelConnection) ExecuteRequest(ctx context.Context, options *ExecuteRequestContent) (*ExecuteResult, error) {
+	content := *options
+	if k.StdinHandler == nil {
+		content.AllowStdin = false
+	}
+	msg, err := k.NewMessage("shell", "execute_request", content)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, iopub, err := k.Request(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ExecuteResult{Message: reply, IOPub: iopub}
+	if err := json.Unmarshal(reply.Content, &result.Reply); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (k *KernelConnection) Interrupt(ctx context.Context) error {
+	msg, err := k.NewMessage("control", "interrupt_request", map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	_, _, err = k.Request(ctx, msg)
+	return err
+}
+
+func (k *KernelConnection) Shutdown(ctx context.Context, restart bool) error {
+	msg, err := k.NewMessage("control", "shutdown_request", map[string]interface{}{"restart": restart})
+	if err != nil {
+		return err
+	}
+	_, _, err = k.Request(ctx, msg)
+	return err
+}
+
+// Binary websocket frames carry buffers using the jupyter server layout: a
+// big endian uint32 count n, n uint32 offsets, the json message then buffers.
+func serializeBinaryMessage(msg *KernelMessage) ([]byte, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := append([][]byte{data}, msg.Buffers...)
+	offset := 4 * (len(parts) + 1)
+	out := binary.BigEndian.AppendUint32(nil, uint32(len(parts)))
+	for _, part := range parts {
+		out = binary.BigEndian.AppendUint32(out, uint32(offset))
+		offset += len(part)
+	}
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out, nil
+}
+
+func deserializeBinaryMessage(data []byte) (*KernelMessage, error) {
+	if len(data) < 4 {
+		return nil, errors.New("binary kernel message too short")
+	}
+	n := int(binary.BigEndian.Uint32(data))
+	if n < 1 || len(data) < 4*(n+1) {
+		return nil, errors.New("binary kernel message has invalid offsets")
+	}
+
+	offsets := make([]int, n+1)
+	for i := 0; i < n; i++ {
+		offsets[i] = int(binary.BigEndian.Uint32(data[4*(i+1):]))
+	}
+	offsets[n] = len(data)
+
+	parts := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		if offsets[i] > offsets[i+1] || offsets[i+1] > len(data) {
+			return nil, errors.New("binary kernel message has invalid offsets")
+		}
+		parts[i] = data[offsets[i]:offsets[i+1]]
+	}
+
+	var msg KernelMessage
+	if err := json.Unmarshal(parts[0], &msg); err != nil {
+		return nil, err
+	}
+	msg.Buffers = parts[1:]
+	return &msg, nil
+}
+
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
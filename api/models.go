@@ -1,13 +1,51 @@
 package api
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/costrouc/go-jupyterlab-api/nbformat"
 )
 
 type ClientConfig struct {
 	ApiToken string
 	ApiURL   string
+	// HTTPClient is shared by every request so connections are reused
+	HTTPClient *http.Client
+	UserAgent  string
+	// RetryPolicy is consulted after failed attempts, nil disables retries
+	RetryPolicy RetryPolicy
+	// Authenticator replaces the default bearer ApiToken authentication
+	Authenticator Authenticator
+	// WebsocketDialer replaces the dialer derived from HTTPClient
+	WebsocketDialer WebsocketDialer
+
+	// set by WithURL and WithBaseURL and resolved into ApiURL by CreateClient
+	url     string
+	baseURL string
+	// set by WithCookieAuth and installed on HTTPClient by CreateClient, the
+	// api token becomes optional
+	cookieJar http.CookieJar
+}
+
+// ServerInfo is the content of a jpserver-*.json runtime file.
+type ServerInfo struct {
+	URL      string `json:"url"`
+	BaseURL  string `json:"base_url"`
+	Token    string `json:"token"`
+	Pid      int    `json:"pid"`
+	Port     int    `json:"port"`
+	Hostname string `json:"hostname"`
+	RootDir  string `json:"root_dir"`
+	Secure   bool   `json:"secure"`
+	Password bool   `json:"password"`
+	Sock     string `json:"sock"`
+	Version  string `json:"version"`
 }
 
 type GetVersionResponse struct {
@@ -21,9 +59,48 @@ type GetStatusResponse struct {
 	Started      string `json:"started"`
 }
 
+type Identity struct {
+	Username    string `json:"username"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Initials    string `json:"initials"`
+	AvatarURL   string `json:"avatar_url"`
+	Color       string `json:"color"`
+}
+
+// Permissions maps a resource such as contents or kernels to actions.
+type Permissions map[string][]string
+
+func (p Permissions) Can(resource string, action string) bool {
+	for _, allowed := range p[resource] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+type GetMeParams struct {
+	// Permissions to check, the server only returns those that are granted
+	Permissions Permissions
+}
+
+func (r *GetMeParams) Encode() string {
+	v := url.Values{}
+	if r.Permissions != nil {
+		data, _ := json.Marshal(r.Permissions)
+		v.Set("permissions", string(data))
+	}
+	return v.Encode()
+}
+
 type GetMeResponse struct {
-	Identity    interface{} `json:"identity"`
-	Permissions interface{} `json:"permissions"`
+	Identity    Identity    `json:"identity"`
+	Permissions Permissions `json:"permissions"`
+}
+
+func (r *GetMeResponse) Can(resource string, action string) bool {
+	return r.Permissions.Can(resource, action)
 }
 
 type GetContentsParams struct {
@@ -39,7 +116,7 @@ func (r *GetContentsParams) Encode() string {
 		v.Set("type", r.Type)
 	}
 	if r.Format != "" {
-		v.Set("type", r.Format)
+		v.Set("format", r.Format)
 	}
 	if r.Content != 1 {
 		v.Set("content", fmt.Sprintf("%d", r.Content))
@@ -51,21 +128,83 @@ func (r *GetContentsParams) Encode() string {
 }
 
 type Content struct {
-	Name          string    `json:"name"`
-	Path          string    `json:"path"`
-	LastModified  string    `json:"last_modified"`
-	Created       string    `json:"created"`
-	Content       []Content `json:"content"`
-	Format        string    `json:"format"`
-	Mimetype      string    `json:"mimetype"`
-	Size          int       `json:"size"`
-	Type          string    `json:"type"`
-	Writeable     bool      `json:"writeable"`
-	Hash          string    `json:"hash"`
-	HashAlgorithm string    `json:"hash_algorithm"`
-}
-
-type GetContentsResponse Content
+	Name          string          `json:"name"`
+	Path          string          `json:"path"`
+	LastModified  string          `json:"last_modified"`
+	Created       string          `json:"created"`
+	Content       json.RawMessage `json:"content"`
+	Format        string          `json:"format"`
+	Mimetype      string          `json:"mimetype"`
+	Size          int             `json:"size"`
+	Type          string          `json:"type"`
+	Writeable     bool            `json:"writeable"`
+	Hash          string          `json:"hash"`
+	HashAlgorithm string          `json:"hash_algorithm"`
+
+	children []Content
+	text     string
+	bytes    []byte
+	notebook *nbformat.Notebook
+}
+
+// UnmarshalJSON decodes the content field according to type and format, a
+// directory lists children, a notebook is a json document and a file is
+// either text or base64 encoded bytes.
+func (c *Content) UnmarshalJSON(data []byte) error {
+	type content Content
+	*c = Content{}
+	if err := json.Unmarshal(data, (*content)(c)); err != nil {
+		return err
+	}
+	if len(c.Content) == 0 || string(c.Content) == "null" {
+		return nil
+	}
+
+	switch {
+	case c.Type == "directory":
+		return json.Unmarshal(c.Content, &c.children)
+	case c.Type == "notebook" && c.Format == "json":
+		return json.Unmarshal(c.Content, &c.notebook)
+	case c.Format == "base64":
+		var encoded string
+		if err := json.Unmarshal(c.Content, &encoded); err != nil {
+			return err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(encoded, "\n", ""))
+		if err != nil {
+			return fmt.Errorf("decoding base64 content of %s: %w", c.Path, err)
+		}
+		c.bytes = decoded
+	case c.Format == "text":
+		if err := json.Unmarshal(c.Content, &c.text); err != nil {
+			return err
+		}
+		c.bytes = []byte(c.text)
+	}
+	return nil
+}
+
+// Children returns the directory listing when Type is directory.
+func (c *Content) Children() []Content {
+	return c.children
+}
+
+// Text returns the file contents when fetched with format text.
+func (c *Content) Text() string {
+	return c.text
+}
+
+// Bytes returns the file contents for both text and base64 formats.
+func (c *Content) Bytes() []byte {
+	return c.bytes
+}
+
+// Notebook returns the parsed notebook when Type is notebook.
+func (c *Content) Notebook() *nbformat.Notebook {
+	return c.notebook
+}
+
+type GetContentsResponse = Content
 
 type CreateContentsBody struct {
 	CopyFrom string `json:"copy_from,omitempty"`
@@ -73,30 +212,74 @@ type CreateContentsBody struct {
 	Type     string `json:"type,omitempty"`
 }
 
-type CreateContentsResponse Content
+type CreateContentsResponse = Content
 
 type PatchContentsBody struct {
 	Path string `json:"path"`
 }
 
-type PatchContentsResponse Content
+type PatchContentsResponse = Content
 
 type PutContentsBody struct {
-	Content string `json:"content"`
-	Format  string `json:"format"` // json, text, base64
-	Name    string `json:"name"`
-	Path    string `json:"path"`
-	Type    string `json:"type"` // notebook, file, directory
+	Content interface{} `json:"content"`
+	Format  string      `json:"format"` // json, text, base64
+	Name    string      `json:"name"`
+	Path    string      `json:"path"`
+	Type    string      `json:"type"` // notebook, file, directory
+	// Chunk numbers chunked uploads from 1 with -1 marking the final chunk
+	Chunk int `json:"chunk,omitempty"`
+}
+
+type PutContentsResponse = Content
+
+type UploadFileOptions struct {
+	// ChunkSize is the number of raw bytes sent per request, defaults to 1MiB
+	ChunkSize int
+	// Progress is called after each chunk with the total bytes uploaded
+	Progress func(uploaded int64)
 }
 
-type PutContentsResponse Content
+type DownloadFileOptions struct {
+	// Raw streams the file from /files/{path} without buffering the body
+	Raw bool
+}
+
+type Checkpoint struct {
+	Id           string `json:"id"`
+	LastModified string `json:"last_modified"`
+}
+
+type ListCheckpointsResponse []Checkpoint
+
+type CreateCheckpointResponse Checkpoint
 
 type Session struct {
-	Id     string      `json:"id"`
-	Kernel interface{} `json:"kernel"`
-	Name   string      `json:"name"`
-	Path   string      `json:"path"`
-	Type   string      `json:"type"`
+	Id     string `json:"id"`
+	Kernel Kernel `json:"kernel"`
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+}
+
+// SessionKernel selects the kernel of a session, either an existing kernel by
+// Id or a new kernel started from the kernelspec Name.
+type SessionKernel struct {
+	Id   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type CreateSessionBody struct {
+	Path   string        `json:"path"`
+	Name   string        `json:"name,omitempty"`
+	Type   string        `json:"type"` // notebook, console, file
+	Kernel SessionKernel `json:"kernel"`
+}
+
+type PatchSessionBody struct {
+	Path   string         `json:"path,omitempty"`
+	Name   string         `json:"name,omitempty"`
+	Type   string         `json:"type,omitempty"`
+	Kernel *SessionKernel `json:"kernel,omitempty"`
 }
 
 type GetSessionsResponse []Session
@@ -107,9 +290,20 @@ type GetSessionResponse Session
 
 type PatchSessionResponse Session
 
+// KernelSpecFile is the kernel.json describing how to launch a kernel.
+type KernelSpecFile struct {
+	Argv          []string               `json:"argv"`
+	DisplayName   string                 `json:"display_name"`
+	Language      string                 `json:"language"`
+	InterruptMode string                 `json:"interrupt_mode"` // signal, message
+	Env           map[string]string      `json:"env"`
+	Metadata      map[string]interface{} `json:"metadata"`
+}
+
 type KernelSpec struct {
-	Name      string            `json:"name"`
-	Spec      interface{}       `json:"spec"`
+	Name string         `json:"name"`
+	Spec KernelSpecFile `json:"spec"`
+	// Resources maps a file such as logo-64x64 to its url path on the server
 	Resources map[string]string `json:"resources"`
 }
 
@@ -118,6 +312,22 @@ type GetKernelSpecsResponse struct {
 	KernelSpecs map[string]KernelSpec `json:"kernelspecs"`
 }
 
+// ByLanguage returns the kernel specs for language sorted by name.
+func (r *GetKernelSpecsResponse) ByLanguage(language string) []KernelSpec {
+	var specs []KernelSpec
+	for _, spec := range r.KernelSpecs {
+		if strings.EqualFold(spec.Spec.Language, language) {
+			specs = append(specs, spec)
+		}
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Name < specs[j].Name
+	})
+	return specs
+}
+
+type GetKernelSpecResponse KernelSpec
+
 type Kernel struct {
 	Id             string `json:"id"`
 	Name           string `json:"name"`
@@ -137,6 +347,12 @@ type CreateKernelResponse Kernel
 
 type GetKernelResponse Kernel
 
+type ConfigSection map[string]interface{}
+
+type GetConfigSectionResponse ConfigSection
+
+type PatchConfigSectionResponse ConfigSection
+
 type Terminal struct {
 	LastActivity string `json:"last_activity"`
 	Name         string `json:"name"`
@@ -147,3 +363,93 @@ type GetTerminalsResponse []Terminal
 type CreateTerminalResponse Terminal
 
 type GetTerminalResponse Terminal
+
+type KernelMessageHeader struct {
+	MsgId    string `json:"msg_id,omitempty"`
+	MsgType  string `json:"msg_type,omitempty"`
+	Username string `json:"username,omitempty"`
+	Session  string `json:"session,omitempty"`
+	Date     string `json:"date,omitempty"`
+	Version  string `json:"version,omitempty"`
+}
+
+type KernelMessage struct {
+	Channel      string                 `json:"channel"`
+	Header       KernelMessageHeader    `json:"header"`
+	ParentHeader KernelMessageHeader    `json:"parent_header"`
+	Metadata     map[string]interface{} `json:"metadata"`
+	Content      json.RawMessage        `json:"content"`
+	Buffers      [][]byte               `json:"-"`
+}
+
+type ExecuteRequestContent struct {
+	Code            string            `json:"code"`
+	Silent          bool              `json:"silent"`
+	StoreHistory    bool              `json:"store_history"`
+	UserExpressions map[string]string `json:"user_expressions"`
+	AllowStdin      bool              `json:"allow_stdin"`
+	StopOnError     bool              `json:"stop_on_error"`
+}
+
+type ExecuteReplyContent struct {
+	Status         string   `json:"status"` // ok, error, aborted
+	ExecutionCount int      `json:"execution_count"`
+	Ename          string   `json:"ename,omitempty"`
+	Evalue         string   `json:"evalue,omitempty"`
+	Traceback      []string `json:"traceback,omitempty"`
+}
+
+type KernelStatusContent struct {
+	ExecutionState string `json:"execution_state"` // busy, idle, starting
+}
+
+type StreamContent struct {
+	Name string `json:"name"` // stdout, stderr
+	Text string `json:"text"`
+}
+
+type DisplayDataContent struct {
+	Data      map[string]interface{} `json:"data"`
+	Metadata  map[string]interface{} `json:"metadata"`
+	Transient map[string]interface{} `json:"transient,omitempty"`
+}
+
+type ExecuteResultContent struct {
+	ExecutionCount int                    `json:"execution_count"`
+	Data           map[string]interface{} `json:"data"`
+	Metadata       map[string]interface{} `json:"metadata"`
+}
+
+type ErrorContent struct {
+	Ename     string   `json:"ename"`
+	Evalue    string   `json:"evalue"`
+	Traceback []string `json:"traceback"`
+}
+
+type ClearOutputContent struct {
+	Wait bool `json:"wait"`
+}
+
+type InputRequestContent struct {
+	Prompt   string `json:"prompt"`
+	Password bool   `json:"password"`
+}
+
+type InputReplyContent struct {
+	Value string `json:"value"`
+}
+
+type KernelInfoReplyContent struct {
+	Status                string                 `json:"status"`
+	ProtocolVersion       string                 `json:"protocol_version"`
+	Implementation        string                 `json:"implementation"`
+	ImplementationVersion string                 `json:"implementation_version"`
+	LanguageInfo          map[string]interface{} `json:"language_info"`
+	Banner                string                 `json:"banner"`
+}
+
+type ExecuteResult struct {
+	Reply   ExecuteReplyContent
+	Message *KernelMessage
+	IOPub   []*KernelMessage
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type ClientOption func(*ClientConfig) error
+
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *ClientConfig) error {
+		if client == nil {
+			return errors.New("http client must not be nil")
+		}
+		c.HTTPClient = client
+		return nil
+	}
+}
+
+// WithTimeout limits the time of each request including reading the body.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *ClientConfig) error {
+		client := *c.httpClient()
+		client.Timeout = timeout
+		c.HTTPClient = &client
+		return nil
+	}
+}
+
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(c *ClientConfig) error {
+		client := *c.httpClient()
+		transport, ok := client.Transport.(*http.Transport)
+		if client.Transport == nil {
+			transport, ok = http.DefaultTransport.(*http.Transport)
+		}
+		if !ok {
+			return errors.New("tls config requires the http client to use an *http.Transport")
+		}
+		transport = transport.Clone()
+		transport.TLSClientConfig = config
+		client.Transport = transport
+		c.HTTPClient = &client
+		return nil
+	}
+}
+
+func WithToken(token string) ClientOption {
+	return func(c *ClientConfig) error {
+		c.ApiToken = token
+		return nil
+	}
+}
+
+// WithURL sets the root url of the jupyter server e.g. http://localhost:8888,
+// it is ignored when ClientConfig.ApiURL is set.
+func WithURL(url string) ClientOption {
+	return func(c *ClientConfig) error {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return fmt.Errorf("server url %q must start with http:// or https://", url)
+		}
+		c.url = url
+		return nil
+	}
+}
+
+// WithBaseURL sets the base_url prefix the server is served under, for
+// example /user/alice/ for a JupyterHub single-user server.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *ClientConfig) error {
+		c.baseURL = baseURL
+		return nil
+	}
+}
+
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *ClientConfig) error {
+		c.UserAgent = userAgent
+		return nil
+	}
+}
+
+func (c *ClientConfig) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/costrouc/go-jupyterlab-api/nbformat"
+)
+
+// OutputCollector folds iopub messages into notebook outputs like a
+// JupyterLab output area: consecutive stream messages of the same name are
+// merged, clear_output with wait clears on the next output and
+// update_display_data replaces every output shown with its display_id.
+type OutputCollector struct {
+	outputs   []nbformat.Output
+	clearNext bool
+	// displays maps a display_id to the indices of its outputs
+	displays map[string][]int
+}
+
+type outputContent struct {
+	Name           string              `json:"name"`
+	Text           string              `json:"text"`
+	Data           nbformat.MimeBundle `json:"data"`
+	Metadata       nbformat.Metadata   `json:"metadata"`
+	ExecutionCount *int                `json:"execution_count"`
+	Ename          string              `json:"ename"`
+	Evalue         string              `json:"evalue"`
+	Traceback      []string            `json:"traceback"`
+	Transient      struct {
+		DisplayId string `json:"display_id"`
+	} `json:"transient"`
+}
+
+// CollectOutputs folds messages, usually ExecuteResult.IOPub, into outputs.
+func CollectOutputs(messages []*KernelMessage) ([]nbformat.Output, error) {
+	var collector OutputCollector
+	for _, msg := range messages {
+		if err := collector.Add(msg); err != nil {
+			return nil, err
+		}
+	}
+	return collector.Outputs(), nil
+}
+
+func (r *ExecuteResult) Outputs() ([]nbformat.Output, error) {
+	return CollectOutputs(r.IOPub)
+}
+
+// Add applies a message, messages which do not change outputs are ignored.
+func (o *OutputCollector) Add(msg *KernelMessage) error {
+	switch msg.Header.MsgType {
+	case "clear_output":
+		var content ClearOutputContent
+		if err := json.Unmarshal(msg.Content, &content); err != nil {
+			return err
+		}
+		if content.Wait {
+			o.clearNext = true
+		} else {
+			o.clear()
+		}
+	case "update_display_data":
+		var content outputContent
+		if err := json.Unmarshal(msg.Content, &content); err != nil {
+			return err
+		}
+		for _, i := range o.displays[content.Transient.DisplayId] {
+			o.outputs[i].Data = content.Data
+			o.outputs[i].Metadata = content.Metadata
+		}
+	case nbformat.OutputTypeStream, nbformat.OutputTypeDisplayData, nbformat.OutputTypeExecuteResult, nbformat.OutputTypeError:
+		var content outputContent
+		if err := json.Unmarshal(msg.Content, &content); err != nil {
+			return err
+		}
+		o.add(msg.Header.MsgType, &content)
+	}
+	return nil
+}
+
+func (o *OutputCollector) clear() {
+	o.outputs = nil
+	o.displays = nil
+}
+
+func (o *OutputCollector) add(outputType string, content *outputContent) {
+	if o.clearNext {
+		o.clear()
+		o.clearNext = false
+	}
+
+	output := nbformat.Output{OutputType: outputType}
+	switch outputType {
+	case nbformat.OutputTypeStream:
+		if n := len(o.outputs); n > 0 && o.outputs[n-1].OutputType == nbformat.OutputTypeStream && o.outputs[n-1].Name == content.Name {
+			last := &o.outputs[n-1]
+			last.Text = nbformat.MultilineString(removeOverwrittenChars(string(last.Text) + content.Text))
+			return
+		}
+		output.Name = content.Name
+		output.Text = nbformat.MultilineString(removeOverwrittenChars(content.Text))
+	case nbformat.OutputTypeDisplayData, nbformat.OutputTypeExecuteResult:
+		output.Data = content.Data
+		output.Metadata = content.Metadata
+		if outputType == nbformat.OutputTypeExecuteResult {
+			output.ExecutionCount = content.ExecutionCount
+		}
+	case nbformat.OutputTypeError:
+		output.Ename = content.Ename
+		output.Evalue = content.Evalue
+		output.Traceback = content.Traceback
+	}
+	o.outputs = append(o.outputs, output)
+
+	if id := content.Transient.DisplayId; id != "" && outputType != nbformat.OutputTypeStream {
+		if o.displays == nil {
+			o.displays = map[string][]int{}
+		}
+		o.displays[id] = append(o.displays[id], len(o.outputs)-1)
+	}
+}
+
+// Outputs returns a copy of the current outputs.
+func (o *OutputCollector) Outputs() []nbformat.Output {
+	return append([]nbformat.Output{}, o.outputs...)
+}
+
+// removeOverwrittenChars applies backspaces and carriage returns the way
+// JupyterLab renders streams, so progress bars keep only their last state.
+func removeOverwrittenChars(text string) string {
+	return fixCarriageReturn(fixBackspace(text))
+}
+
+func fixBackspace(text string) string {
+	result := make([]rune, 0, len(text))
+	for _, r := range text {
+		if r == '\b' && len(result) > 0 && result[len(result)-1] != '\n' {
+			result = result[:len(result)-1]
+			continue
+		}
+		result = append(result, r)
+	}
+	return string(result)
+}
+
+// fixCarriageReturn overwrites the start of a line with the text following
+// each carriage return. A trailing carriage return is kept so text from a
+// later stream message still overwrites the line.
+func fixCarriageReturn(text string) string {
+	for strings.Contains(text, "\r\n") {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if !strings.Contains(line, "\r") {
+			continue
+		}
+		segments := strings.Split(line, "\r")
+		current := []rune(segments[0])
+		for _, segment := range segments[1:] {
+			overwrite := []rune(segment)
+			if len(overwrite) < len(current) {
+				overwrite = append(overwrite, current[len(overwrite):]...)
+			}
+			current = overwrite
+		}
+		lines[i] = string(current)
+		if strings.HasSuffix(line, "\r") {
+			lines[i] += "\r"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
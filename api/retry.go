@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides if a failed attempt is retried and how long to wait
+// before the next attempt. resp is nil when the request returned err.
+type RetryPolicy interface {
+	Retry(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool)
+}
+
+// BackoffRetryPolicy retries idempotent requests on connection refused, 429,
+// 502, 503 and 504 with exponential backoff and jitter. A Retry-After header
+// on the response takes precedence over the computed backoff, the response is
+// returned without retrying when it asks to wait longer than MaxBackoff.
+type BackoffRetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+func DefaultRetryPolicy() *BackoffRetryPolicy {
+	return &BackoffRetryPolicy{
+		MaxAttempts: 5,
+		MinBackoff:  250 * time.Millisecond,
+		MaxBackoff:  10 * time.Second,
+	}
+}
+
+func (p *BackoffRetryPolicy) Retry(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return 0, false
+	}
+
+	if err != nil {
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			return 0, false
+		}
+		return p.backoff(attempt), true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+	default:
+		return 0, false
+	}
+	if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		return delay, delay <= p.MaxBackoff
+	}
+	return p.backoff(attempt), true
+}
+
+func (p *BackoffRetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.MinBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	// equal jitter keeps at least half of the backoff
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *ClientConfig) error {
+		c.RetryPolicy = policy
+		return nil
+	}
+}
+
+const readyPollInterval = 500 * time.Millisecond
+
+type noRetryKey struct{}
+
+// withoutRetry marks requests that must not be repeated, such as appending
+// a chunk to an upload.
+func withoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// WaitUntilReady polls GetStatus until the server answers or ctx is done.
+// Responses other than 429 and 5XX are returned immediately since they mean
+// the server is up but rejected the request.
+func (c *ClientConfig) WaitUntilReady(ctx context.Context) error {
+	for {
+		_, err := c.GetStatus(ctx)
+		if err == nil {
+			return nil
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode != http.StatusTooManyRequests && apiErr.StatusCode < 500 {
+			return err
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("server not ready: %w", err)
+		}
+		if sleepErr := sleepContext(ctx, readyPollInterval); sleepErr != nil {
+			return fmt.Errorf("server not ready: %w", err)
+		}
+	}
+}
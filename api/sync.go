@@ -0,0 +1,381 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type SyncDirection string
+
+const (
+	// SyncUpload makes the remote directory match the local one
+	SyncUpload SyncDirection = "upload"
+	// SyncDownload makes the local directory match the remote one
+	SyncDownload SyncDirection = "download"
+	// SyncBoth copies missing files both ways and keeps the newer of two files
+	SyncBoth SyncDirection = "both"
+)
+
+type SyncActionType string
+
+const (
+	SyncActionUpload       SyncActionType = "upload"
+	SyncActionDownload     SyncActionType = "download"
+	SyncActionMkdirRemote  SyncActionType = "mkdir-remote"
+	SyncActionMkdirLocal   SyncActionType = "mkdir-local"
+	SyncActionDeleteRemote SyncActionType = "delete-remote"
+	SyncActionDeleteLocal  SyncActionType = "delete-local"
+)
+
+type SyncOptions struct {
+	Direction SyncDirection
+	// Delete removes files missing from the source side, ignored for SyncBoth
+	Delete bool
+	// DryRun only computes the plan without changing either side
+	DryRun bool
+	// Include and Exclude are path.Match globs tested against the slash
+	// separated relative path and the base name. Include only filters files.
+	Include []string
+	Exclude []string
+}
+
+type SyncAction struct {
+	Type   SyncActionType
+	Path   string
+	Reason string
+}
+
+type SyncPlan struct {
+	Actions []SyncAction
+}
+
+func (p *SyncPlan) String() string {
+	var b strings.Builder
+	for _, action := range p.Actions {
+		fmt.Fprintf(&b, "%-13s %s (%s)\n", action.Type, action.Path, action.Reason)
+	}
+	return b.String()
+}
+
+type syncEntry struct {
+	dir     bool
+	size    int64
+	modTime time.Time
+	// remote entries are only fetched with a hash when sizes match
+	hash          string
+	hashAlgorithm string
+}
+
+// Sync walks localDir and remoteDir and converges them according to the
+// options direction. Files are compared by size, then by hash when the server
+// reports a sha256 hash, and finally by modification time. Only the
+// destination directory may be missing, a missing source is an error.
+func (c *ClientConfig) Sync(ctx context.Context, localDir string, remoteDir string, options *SyncOptions) (*SyncPlan, error) {
+	if options == nil {
+		options = &SyncOptions{}
+	}
+	if options.Direction == "" {
+		options.Direction = SyncUpload
+	}
+	remoteDir = strings.Trim(remoteDir, "/")
+
+	local, err := walkLocal(localDir, options)
+	if err != nil {
+		return nil, err
+	}
+	remote := map[string]*syncEntry{}
+	remoteExists := true
+	if remoteDir != "" {
+		// a missing root is only empty when uploading, otherwise a typo in
+		// the path would plan deleting every local file
+		if _, err := c.GetContents(ctx, remoteDir, &GetContentsParams{Content: 0}); err != nil {
+			if !IsNotFound(err) || options.Direction != SyncUpload {
+				return nil, err
+			}
+			remoteExists = false
+		}
+	}
+	if remoteExists {
+		if err := c.walkRemote(ctx, remoteDir, "", options, remote); err != nil {
+			return nil, err
+		}
+	}
+
+	plan, err := c.planSync(ctx, localDir, remoteDir, local, remote, options)
+	if err != nil {
+		return nil, err
+	}
+	if options.DryRun {
+		return plan, nil
+	}
+
+	if !remoteExists && plan.writesRemote() {
+		// the contents api does not create missing parents on save
+		parts := strings.Split(remoteDir, "/")
+		for i := range parts {
+			if _, err := c.PutContents(ctx, path.Join(parts[:i+1]...), &PutContentsBody{Type: "directory"}); err != nil {
+				return plan, fmt.Errorf("sync %s %s: %w", SyncActionMkdirRemote, remoteDir, err)
+			}
+		}
+	}
+
+	for _, action := range plan.Actions {
+		if err := c.applySyncAction(ctx, localDir, remoteDir, action); err != nil {
+			return plan, fmt.Errorf("sync %s %s: %w", action.Type, action.Path, err)
+		}
+	}
+	return plan, nil
+}
+
+func (p *SyncPlan) writesRemote() bool {
+	for _, action := range p.Actions {
+		if action.Type == SyncActionUpload || action.Type == SyncActionMkdirRemote {
+			return true
+		}
+	}
+	return false
+}
+
+func syncMatch(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func syncExcluded(options *SyncOptions, rel string, dir bool) bool {
+	if syncMatch(options.Exclude, rel) {
+		return true
+	}
+	return !dir && len(options.Include) > 0 && !syncMatch(options.Include, rel)
+}
+
+func walkLocal(root string, options *SyncOptions) (map[string]*syncEntry, error) {
+	entries := map[string]*syncEntry{}
+	if _, err := os.Stat(root); os.IsNotExist(err) && options.Direction == SyncDownload {
+		return entries, nil
+	}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if syncExcluded(options, rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries[rel] = &syncEntry{dir: d.IsDir(), size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return entries, err
+}
+
+func (c *ClientConfig) walkRemote(ctx context.Context, root string, rel string, options *SyncOptions, entries map[string]*syncEntry) error {
+	result, err := c.GetContents(ctx, path.Join(root, rel), nil)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range result.Children() {
+		childRel := path.Join(rel, child.Name)
+		dir := child.Type == "directory"
+		if syncExcluded(options, childRel, dir) {
+			continue
+		}
+
+		modTime, _ := time.Parse(time.RFC3339Nano, child.LastModified)
+		entries[childRel] = &syncEntry{dir: dir, size: int64(child.Size), modTime: modTime}
+		if dir {
+			if err := c.walkRemote(ctx, root, childRel, options, entries); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncChanged reports whether the two files differ and if so whether the
+// local copy is the newer of the two.
+func (c *ClientConfig) syncChanged(ctx context.Context, localDir string, remoteDir string, rel string, local *syncEntry, remote *syncEntry) (bool, bool, error) {
+	localNewer := local.modTime.After(remote.modTime)
+	if local.size != remote.size {
+		return true, localNewer, nil
+	}
+
+	result, err := c.GetContents(ctx, path.Join(remoteDir, rel), &GetContentsParams{Type: "file", Content: 0, Hash: 1})
+	if err != nil {
+		return false, false, err
+	}
+	if result.Hash != "" && result.HashAlgorithm == "sha256" {
+		localHash, err := hashLocalFile(filepath.Join(localDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return false, false, err
+		}
+		return localHash != result.Hash, localNewer, nil
+	}
+
+	// without a hash fall back to timestamps, the server reports sub second
+	// precision that local filesystems may not preserve
+	diff := local.modTime.Sub(remote.modTime)
+	return diff > time.Second || diff < -time.Second, localNewer, nil
+}
+
+func hashLocalFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *ClientConfig) planSync(ctx context.Context, localDir string, remoteDir string, local map[string]*syncEntry, remote map[string]*syncEntry, options *SyncOptions) (*SyncPlan, error) {
+	upload := options.Direction == SyncUpload || options.Direction == SyncBoth
+	download := options.Direction == SyncDownload || options.Direction == SyncBoth
+	if !upload && !download {
+		return nil, fmt.Errorf("unknown sync direction %q", options.Direction)
+	}
+	prune := options.Delete && options.Direction != SyncBoth
+
+	paths := make([]string, 0, len(local)+len(remote))
+	for rel := range local {
+		paths = append(paths, rel)
+	}
+	for rel := range remote {
+		if _, ok := local[rel]; !ok {
+			paths = append(paths, rel)
+		}
+	}
+	// parents sort before their children so directories are created first
+	sort.Strings(paths)
+
+	plan := SyncPlan{}
+	var deletes []SyncAction
+	for _, rel := range paths {
+		l, r := local[rel], remote[rel]
+		switch {
+		case l != nil && r == nil:
+			if upload {
+				if l.dir {
+					plan.Actions = append(plan.Actions, SyncAction{SyncActionMkdirRemote, rel, "missing on server"})
+				} else {
+					plan.Actions = append(plan.Actions, SyncAction{SyncActionUpload, rel, "missing on server"})
+				}
+			} else if prune {
+				deletes = append(deletes, SyncAction{SyncActionDeleteLocal, rel, "missing on server"})
+			}
+		case l == nil && r != nil:
+			if download {
+				if r.dir {
+					plan.Actions = append(plan.Actions, SyncAction{SyncActionMkdirLocal, rel, "missing locally"})
+				} else {
+					plan.Actions = append(plan.Actions, SyncAction{SyncActionDownload, rel, "missing locally"})
+				}
+			} else if prune {
+				deletes = append(deletes, SyncAction{SyncActionDeleteRemote, rel, "missing locally"})
+			}
+		case l.dir != r.dir:
+			return nil, fmt.Errorf("%s is a directory on one side and a file on the other", rel)
+		case !l.dir:
+			changed, localNewer, err := c.syncChanged(ctx, localDir, remoteDir, rel, l, r)
+			if err != nil {
+				return nil, err
+			}
+			if !changed {
+				continue
+			}
+			if options.Direction == SyncUpload || (options.Direction == SyncBoth && localNewer) {
+				plan.Actions = append(plan.Actions, SyncAction{SyncActionUpload, rel, "changed"})
+			} else {
+				plan.Actions = append(plan.Actions, SyncAction{SyncActionDownload, rel, "changed"})
+			}
+		}
+	}
+
+	// delete children before their parent directories
+	for i := len(deletes) - 1; i >= 0; i-- {
+		plan.Actions = append(plan.Actions, deletes[i])
+	}
+	return &plan, nil
+}
+
+func (c *ClientConfig) applySyncAction(ctx context.Context, localDir string, remoteDir string, action SyncAction) error {
+	localPath := filepath.Join(localDir, filepath.FromSlash(action.Path))
+	remotePath := path.Join(remoteDir, action.Path)
+
+	switch action.Type {
+	case SyncActionMkdirRemote:
+		_, err := c.PutContents(ctx, remotePath, &PutContentsBody{Type: "directory"})
+		return err
+	case SyncActionMkdirLocal:
+		return os.MkdirAll(localPath, 0o755)
+	case SyncActionUpload:
+		f, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = c.UploadFile(ctx, remotePath, f, nil)
+		return err
+	case SyncActionDownload:
+		reader, _, err := c.DownloadFile(ctx, remotePath, &DownloadFileOptions{Raw: true})
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+			return err
+		}
+		f, err := os.Create(localPath)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, reader); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	case SyncActionDeleteRemote:
+		return c.DeleteContents(ctx, remotePath)
+	case SyncActionDeleteLocal:
+		return os.Remove(localPath)
+	}
+	return fmt.Errorf("unknown sync action %q", action.Type)
+}
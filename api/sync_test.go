@@ -0,0 +1,55 @@
+package api_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/costrouc/go-jupyterlab-api/api"
+	"github.com/costrouc/go-jupyterlab-api/jupytertest"
+)
+
+func TestSyncMissingRemote(t *testing.T) {
+	server := jupytertest.NewServer()
+	t.Cleanup(server.Close)
+	client, err := server.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	localDir := t.TempDir()
+	precious := filepath.Join(localDir, "precious.txt")
+	if err := os.WriteFile(precious, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, direction := range []api.SyncDirection{api.SyncDownload, api.SyncBoth} {
+		_, err := client.Sync(ctx, localDir, "typo-dir", &api.SyncOptions{Direction: direction, Delete: true})
+		if !api.IsNotFound(err) {
+			t.Errorf("Expected %s sync from a missing remote to fail with not found, got %v", direction, err)
+		}
+	}
+	if _, err := os.Stat(precious); err != nil {
+		t.Fatalf("Expected local files to survive a failed sync: %v", err)
+	}
+
+	if _, err := client.Sync(ctx, localDir, "new/dir", &api.SyncOptions{Direction: api.SyncUpload, Delete: true}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := client.GetContents(ctx, "new/dir/precious.txt", &api.GetContentsParams{Format: "text", Content: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Text() != "keep" {
+		t.Errorf("Expected upload to create the missing remote root, got %q", data.Text())
+	}
+
+	missingDir := filepath.Join(t.TempDir(), "typo-dir")
+	if _, err := client.Sync(ctx, missingDir, "new", &api.SyncOptions{Direction: api.SyncUpload, Delete: true}); !os.IsNotExist(err) {
+		t.Errorf("Expected upload from a missing local directory to fail, got %v", err)
+	}
+	if _, err := client.GetContents(ctx, "new/dir/precious.txt", nil); err != nil {
+		t.Errorf("Expected remote files to survive a failed sync: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// TerminalConnection streams a terminal over the terminado websocket
+// protocol. Reads return the terminal stdout and writes are sent as stdin.
+type TerminalConnection struct {
+	Name string
+
+	conn    WebsocketConn
+	writeMu sync.Mutex
+	// partial utf-8 sequence held back from the previous Write
+	pending []byte
+
+	reader *io.PipeReader
+	writer *io.PipeWriter
+}
+
+func (c *ClientConfig) ConnectTerminal(ctx context.Context, terminal string) (*TerminalConnection, error) {
+	url := fmt.Sprintf("%s/terminals/websocket/%s", c.serverURL(), terminal)
+	conn, err := c.dialWebsocket(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	t := &TerminalConnection{
+		Name:   terminal,
+		conn:   conn,
+		reader: reader,
+		writer: writer,
+	}
+	go t.readLoop()
+	return t, nil
+}
+
+func (t *TerminalConnection) readLoop() {
+	for {
+		_, data, err := t.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				err = io.EOF
+			}
+			t.writer.CloseWithError(err)
+			return
+		}
+		var message []json.RawMessage
+		if err := json.Unmarshal(data, &message); err != nil || len(message) == 0 {
+			continue
+		}
+
+		var kind string
+		if err := json.Unmarshal(message[0], &kind); err != nil {
+			continue
+		}
+		switch kind {
+		case "stdout":
+			if len(message) < 2 {
+				continue
+			}
+			var text string
+			if err := json.Unmarshal(message[1], &text); err != nil {
+				continue
+			}
+			if _, err := t.writer.Write([]byte(text)); err != nil {
+				return
+			}
+		case "disconnect":
+			t.writer.CloseWithError(io.EOF)
+			return
+		}
+	}
+}
+
+func (t *TerminalConnection) send(message ...interface{}) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return t.sendLocked(message...)
+}
+
+// sendLocked must be called with writeMu held.
+func (t *TerminalConnection) sendLocked(message ...interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return t.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (t *TerminalConnection) Read(p []byte) (int, error) {
+	return t.reader.Read(p)
+}
+
+// Write sends p as stdin. The protocol carries text so a trailing incomplete
+// utf-8 sequence is held back until the next Write completes it.
+func (t *TerminalConnection) Write(p []byte) (int, error) {
+	// writeMu is held while sending so concurrent writes keep their order
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	pending := t.pending
+	data := append(append([]byte(nil), pending...), p...)
+	end := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	t.pending = append([]byte(nil), data[end:]...)
+
+	if end == 0 {
+		return len(p), nil
+	}
+	if err := t.sendLocked("stdin", string(data[:end])); err != nil {
+		// nothing of p was written, keep the bytes held back before it
+		t.pending = pending
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *TerminalConnection) Resize(rows int, cols int) error {
+	if rows <= 0 || cols <= 0 {
+		return errors.New("terminal rows and cols must be positive")
+	}
+	return t.send("set_size", rows, cols)
+}
+
+func (t *TerminalConnection) Close() error {
+	t.writeMu.Lock()
+	_ = t.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	t.writeMu.Unlock()
+	t.reader.Close()
+	return t.conn.Close()
+}
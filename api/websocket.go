@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebsocketConn is the part of a websocket connection used by kernel and
+// terminal connections, message types are those of gorilla/websocket.
+type WebsocketConn interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	Close() error
+}
+
+// WebsocketDialer opens kernel channel and terminal websockets. On a failed
+// handshake the response, when there is one, is returned with the error.
+type WebsocketDialer interface {
+	DialContext(ctx context.Context, url string, header http.Header) (WebsocketConn, *http.Response, error)
+}
+
+type gorillaDialer struct {
+	dialer *websocket.Dialer
+}
+
+func (d *gorillaDialer) DialContext(ctx context.Context, url string, header http.Header) (WebsocketConn, *http.Response, error) {
+	conn, resp, err := d.dialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, resp, err
+	}
+	return conn, resp, nil
+}
+
+// NewWebsocketDialer mirrors the proxy, tls and cookie settings of client.
+func NewWebsocketDialer(client *http.Client) WebsocketDialer {
+	dialer := *websocket.DefaultDialer
+	if transport, ok := client.Transport.(*http.Transport); ok {
+		dialer.Proxy = transport.Proxy
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+	dialer.Jar = client.Jar
+	return &gorillaDialer{dialer: &dialer}
+}
+
+func WithWebsocketDialer(dialer WebsocketDialer) ClientOption {
+	return func(c *ClientConfig) error {
+		c.WebsocketDialer = dialer
+		return nil
+	}
+}
+
+func (c *ClientConfig) websocketDialer() WebsocketDialer {
+	if c.WebsocketDialer != nil {
+		return c.WebsocketDialer
+	}
+	return NewWebsocketDialer(c.httpClient())
+}
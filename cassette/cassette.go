@@ -0,0 +1,322 @@
+// Package cassette records the http requests and websocket frames of an
+// api.ClientConfig into a json file and replays them later, so tests
+// captured once against a real JupyterLab run without a server. Credentials
+// are scrubbed from recorded requests.
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/costrouc/go-jupyterlab-api/api"
+)
+
+type Mode int
+
+const (
+	// ModeReplay serves recorded interactions and fails any other request
+	ModeReplay Mode = iota
+	// ModeRecord performs requests and overwrites the cassette on Stop
+	ModeRecord
+	// ModeRecordOnce records when the cassette does not exist and replays
+	// it otherwise
+	ModeRecordOnce
+)
+
+const redacted = "REDACTED"
+
+var scrubbedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Xsrftoken"}
+
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Body is stored as text when it is valid utf-8 and base64 otherwise.
+type Body []byte
+
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(map[string]string{"text": string(b)})
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var body struct {
+		Text   string `json:"text"`
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+	if body.Base64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(body.Base64)
+		if err != nil {
+			return err
+		}
+		*b = decoded
+		return nil
+	}
+	*b = Body(body.Text)
+	return nil
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+	// Websocket interactions hold the frames exchanged after the handshake
+	Websocket bool    `json:"websocket,omitempty"`
+	Frames    []Frame `json:"frames,omitempty"`
+
+	used bool
+}
+
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("cassette %s: %w", path, err)
+	}
+	return &cassette, nil
+}
+
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Recorder is an http.RoundTripper and api.WebsocketDialer which records to
+// or replays from a cassette depending on its mode.
+type Recorder struct {
+	// Transport performs requests while recording, set by Option from the
+	// client when nil
+	Transport http.RoundTripper
+	// Dialer opens websockets while recording, set by Option from the client
+	// when nil
+	Dialer api.WebsocketDialer
+
+	path     string
+	mode     Mode
+	mu       sync.Mutex
+	cassette *Cassette
+}
+
+func New(path string, mode Mode) (*Recorder, error) {
+	if mode == ModeRecordOnce {
+		mode = ModeReplay
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			mode = ModeRecord
+		}
+	}
+
+	r := &Recorder{path: path, mode: mode, cassette: &Cassette{}}
+	if mode == ModeReplay {
+		cassette, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = cassette
+	}
+	return r, nil
+}
+
+// Mode is either ModeRecord or ModeReplay.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Option routes the requests and websockets of a client through the
+// recorder. While recording they are performed with the client's own
+// transport and websocket dialer.
+func (r *Recorder) Option() api.ClientOption {
+	return func(c *api.ClientConfig) error {
+		client := http.Client{}
+		if c.HTTPClient != nil {
+			client = *c.HTTPClient
+		}
+		if r.Transport == nil {
+			r.Transport = client.Transport
+			if r.Transport == nil {
+				r.Transport = http.DefaultTransport
+			}
+		}
+		if r.Dialer == nil {
+			r.Dialer = c.WebsocketDialer
+			if r.Dialer == nil {
+				r.Dialer = api.NewWebsocketDialer(&client)
+			}
+		}
+		client.Transport = r
+		c.HTTPClient = &client
+		c.WebsocketDialer = r
+		return nil
+	}
+}
+
+// Stop writes the cassette when recording.
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.Save(r.path)
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	request := scrubRequest(req, body)
+
+	if r.mode == ModeReplay {
+		interaction, err := r.match(request, false)
+		if err != nil {
+			return nil, err
+		}
+		return interaction.Response.httpResponse(req), nil
+	}
+
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	r.record(&Interaction{
+		Request:  request,
+		Response: Response{StatusCode: resp.StatusCode, Header: scrubHeader(resp.Header), Body: respBody},
+	})
+	return resp, nil
+}
+
+func (r *Recorder) record(interaction *Interaction) {
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+}
+
+// match returns the first unused interaction for the request. The host is
+// ignored so a cassette recorded against one server replays for any url.
+func (r *Recorder) match(request Request, websocket bool) (*Interaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := matchKey(request.URL)
+	for _, interaction := range r.cassette.Interactions {
+		if interaction.used || interaction.Websocket != websocket || interaction.Request.Method != request.Method {
+			continue
+		}
+		if matchKey(interaction.Request.URL) != key || !bytes.Equal(interaction.Request.Body, request.Body) {
+			continue
+		}
+		interaction.used = true
+		return interaction, nil
+	}
+	return nil, fmt.Errorf("cassette %s: no recorded interaction for %s %s", r.path, request.Method, request.URL)
+}
+
+// matchKey drops the scheme, host and the random kernel channels session_id.
+func matchKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	query.Del("session_id")
+	return u.Path + "?" + query.Encode()
+}
+
+func (resp Response) httpResponse(req *http.Request) *http.Response {
+	header := resp.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}
+}
+
+func scrubRequest(req *http.Request, body []byte) Request {
+	u := *req.URL
+	query := u.Query()
+	if query.Has("token") {
+		query.Set("token", redacted)
+		u.RawQuery = query.Encode()
+	}
+
+	// the login form carries the password
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for _, field := range []string{"password", "_xsrf"} {
+				if form.Has(field) {
+					form.Set(field, redacted)
+				}
+			}
+			body = []byte(form.Encode())
+		}
+	}
+	return Request{Method: req.Method, URL: u.String(), Header: scrubHeader(req.Header), Body: body}
+}
+
+func scrubHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range scrubbedHeaders {
+		if _, ok := header[name]; ok {
+			header.Set(name, redacted)
+		}
+	}
+	return header
+}
@@ -0,0 +1,122 @@
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/costrouc/go-jupyterlab-api/api"
+	"github.com/costrouc/go-jupyterlab-api/jupytertest"
+)
+
+// exercise runs the same interactions while recording and replaying.
+func exercise(t *testing.T, client *api.ClientConfig) {
+	ctx := context.Background()
+
+	if _, err := client.PutContents(ctx, "hello.txt", &api.PutContentsBody{Type: "file", Format: "text", Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := client.GetContents(ctx, "hello.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.Text() != "hello" {
+		t.Errorf("Expected hello, got %q", content.Text())
+	}
+	if _, err := client.GetContents(ctx, "missing.txt", nil); !api.IsNotFound(err) {
+		t.Errorf("Expected not found, got %v", err)
+	}
+	logo, err := client.GetKernelSpecResource(ctx, jupytertest.DefaultKernelSpec, "logo-32x32.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(logo, []byte("\x89PNG")) {
+		t.Errorf("Expected png logo")
+	}
+
+	kernel, err := client.CreateKernel(ctx, api.CreateKernelBody{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.ConnectKernel(ctx, kernel.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := conn.Execute(ctx, "print('hello')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reply.Status != "ok" || result.Reply.ExecutionCount != 1 {
+		t.Errorf("Expected ok reply with execution count 1, got %v", result.Reply)
+	}
+	var streamed string
+	for _, msg := range result.IOPub {
+		if msg.Header.MsgType == "stream" {
+			var stream api.StreamContent
+			if err := json.Unmarshal(msg.Content, &stream); err != nil {
+				t.Fatal(err)
+			}
+			streamed += stream.Text
+		}
+	}
+	if streamed != "hello\n" {
+		t.Errorf("Expected streamed hello, got %q", streamed)
+	}
+	if err := conn.Shutdown(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "kernel.json")
+
+	server := jupytertest.NewServer()
+	server.Execute = func(code string) []jupytertest.KernelOutput {
+		return []jupytertest.KernelOutput{jupytertest.Stream("stdout", "hello\n")}
+	}
+	recorder, err := New(path, ModeRecordOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Mode() != ModeRecord {
+		t.Fatalf("Expected a missing cassette to be recorded")
+	}
+	client, err := server.Client(recorder.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exercise(t, client)
+	if err := recorder.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(server.Token)) {
+		t.Errorf("Expected the api token to be scrubbed from the cassette")
+	}
+
+	recorder, err = New(path, ModeRecordOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Mode() != ModeReplay {
+		t.Fatalf("Expected an existing cassette to be replayed")
+	}
+	client, err = api.CreateClient(&api.ClientConfig{ApiToken: "othertoken"}, api.WithURL("http://jupyter.invalid"), recorder.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exercise(t, client)
+
+	if _, err := client.GetStatus(context.Background()); err == nil {
+		t.Errorf("Expected an error for a request missing from the cassette")
+	}
+}
@@ -0,0 +1,296 @@
+package cassette
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/costrouc/go-jupyterlab-api/api"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	FrameText   = "text"
+	FrameBinary = "binary"
+	// FrameClose ends the connection with the close code in Data
+	FrameClose = "close"
+)
+
+// Frame is a websocket message, Send is true for messages written by the
+// client. Binary data is base64 encoded.
+type Frame struct {
+	Send bool   `json:"send,omitempty"`
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+}
+
+func newFrame(send bool, messageType int, data []byte) Frame {
+	if messageType == websocket.BinaryMessage {
+		return Frame{Send: send, Type: FrameBinary, Data: base64.StdEncoding.EncodeToString(data)}
+	}
+	return Frame{Send: send, Type: FrameText, Data: string(data)}
+}
+
+func (f Frame) message() (int, []byte, error) {
+	if f.Type == FrameBinary {
+		data, err := base64.StdEncoding.DecodeString(f.Data)
+		return websocket.BinaryMessage, data, err
+	}
+	return websocket.TextMessage, []byte(f.Data), nil
+}
+
+func (r *Recorder) DialContext(ctx context.Context, url string, header http.Header) (api.WebsocketConn, *http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header = header
+	request := scrubRequest(req, nil)
+
+	if r.mode == ModeReplay {
+		interaction, err := r.match(request, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		if interaction.Response.StatusCode != http.StatusSwitchingProtocols {
+			return nil, interaction.Response.httpResponse(req), websocket.ErrBadHandshake
+		}
+		return newReplayConn(interaction, url), nil, nil
+	}
+
+	interaction := &Interaction{Request: request, Websocket: true}
+	conn, resp, err := r.Dialer.DialContext(ctx, url, header)
+	if resp != nil {
+		interaction.Response = Response{StatusCode: resp.StatusCode, Header: scrubHeader(resp.Header)}
+	}
+	if err != nil {
+		if resp != nil && resp.Body != nil {
+			// keep the body readable for the caller's error
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = io.NopCloser(strings.NewReader(string(body)))
+			interaction.Response.Body = body
+			r.record(interaction)
+		}
+		return nil, resp, err
+	}
+	interaction.Response.StatusCode = http.StatusSwitchingProtocols
+	r.record(interaction)
+	return &recordingConn{conn: conn, recorder: r, interaction: interaction}, resp, nil
+}
+
+type recordingConn struct {
+	conn        api.WebsocketConn
+	recorder    *Recorder
+	interaction *Interaction
+	closed      bool
+}
+
+func (c *recordingConn) append(frame Frame) {
+	c.recorder.mu.Lock()
+	defer c.recorder.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.interaction.Frames = append(c.interaction.Frames, frame)
+	c.closed = frame.Type == FrameClose
+}
+
+func (c *recordingConn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := c.conn.ReadMessage()
+	if err != nil {
+		code := websocket.CloseAbnormalClosure
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) {
+			code = closeErr.Code
+		}
+		c.append(Frame{Type: FrameClose, Data: strconv.Itoa(code)})
+		return messageType, data, err
+	}
+	c.append(newFrame(false, messageType, data))
+	return messageType, data, nil
+}
+
+func (c *recordingConn) WriteMessage(messageType int, data []byte) error {
+	if err := c.conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	c.append(newFrame(true, messageType, data))
+	return nil
+}
+
+func (c *recordingConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	return c.conn.WriteControl(messageType, data, deadline)
+}
+
+func (c *recordingConn) Close() error {
+	return c.conn.Close()
+}
+
+var errReplayConnClosed = errors.New("cassette: websocket closed")
+
+// replayConn releases each received frame once the client has written every
+// frame sent before it during the recording. Kernel message and session ids
+// of the recording are rewritten to the ones the client used on replay so
+// replies are routed to the live requests.
+type replayConn struct {
+	frames []Frame
+	// sendsBefore counts the frames sent before each frame
+	sendsBefore []int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	sent    int
+	next    int
+	closed  bool
+	renames map[string]string
+}
+
+func newReplayConn(interaction *Interaction, liveURL string) *replayConn {
+	c := &replayConn{frames: interaction.Frames, renames: map[string]string{}}
+	c.cond = sync.NewCond(&c.mu)
+	sends := 0
+	for _, frame := range c.frames {
+		c.sendsBefore = append(c.sendsBefore, sends)
+		if frame.Send {
+			sends++
+		}
+	}
+	c.rename(querySessionId(interaction.Request.URL), querySessionId(liveURL))
+	return c
+}
+
+func querySessionId(rawURL string) string {
+	_, query, _ := strings.Cut(rawURL, "?")
+	for _, pair := range strings.Split(query, "&") {
+		if value, ok := strings.CutPrefix(pair, "session_id="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// rename must be called with c.mu held.
+func (c *replayConn) rename(recorded string, live string) {
+	if recorded != "" && live != "" && recorded != live {
+		c.renames[recorded] = live
+	}
+}
+
+func (c *replayConn) ReadMessage() (int, []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if c.closed {
+			return 0, nil, errReplayConnClosed
+		}
+		// skip the client's own frames, they are consumed by WriteMessage
+		for c.next < len(c.frames) && c.frames[c.next].Send {
+			c.next++
+		}
+		if c.next < len(c.frames) && c.sent >= c.sendsBefore[c.next] {
+			break
+		}
+		c.cond.Wait()
+	}
+
+	frame := c.frames[c.next]
+	c.next++
+	if frame.Type == FrameClose {
+		code, err := strconv.Atoi(frame.Data)
+		if err != nil {
+			code = websocket.CloseAbnormalClosure
+		}
+		c.closed = true
+		return 0, nil, &websocket.CloseError{Code: code}
+	}
+
+	messageType, data, err := frame.message()
+	if err != nil {
+		return 0, nil, err
+	}
+	for recorded, live := range c.renames {
+		data = []byte(strings.ReplaceAll(string(data), recorded, live))
+	}
+	return messageType, data, nil
+}
+
+func (c *replayConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errReplayConnClosed
+	}
+
+	index, sends := 0, 0
+	for ; index < len(c.frames); index++ {
+		if c.frames[index].Send {
+			if sends == c.sent {
+				break
+			}
+			sends++
+		}
+	}
+	if index == len(c.frames) {
+		return errors.New("cassette: websocket message was not recorded")
+	}
+
+	_, recorded, err := c.frames[index].message()
+	if err != nil {
+		return err
+	}
+	recordedHeader := kernelMessageHeader(recorded)
+	liveHeader := kernelMessageHeader(data)
+	c.rename(recordedHeader.MsgId, liveHeader.MsgId)
+	c.rename(recordedHeader.Session, liveHeader.Session)
+
+	c.sent++
+	c.cond.Broadcast()
+	return nil
+}
+
+// kernelMessageHeader reads the header of a kernel message in a text frame or
+// the binary layout carrying buffers.
+func kernelMessageHeader(data []byte) api.KernelMessageHeader {
+	var msg api.KernelMessage
+	if err := json.Unmarshal(data, &msg); err == nil {
+		return msg.Header
+	}
+	if len(data) < 8 {
+		return api.KernelMessageHeader{}
+	}
+	n := binary.BigEndian.Uint32(data)
+	if n < 1 || uint64(len(data)) < 4*(uint64(n)+1) {
+		return api.KernelMessageHeader{}
+	}
+	start := binary.BigEndian.Uint32(data[4:])
+	end := uint32(len(data))
+	if n > 1 {
+		end = binary.BigEndian.Uint32(data[8:])
+	}
+	if start > end || end > uint32(len(data)) {
+		return api.KernelMessageHeader{}
+	}
+	_ = json.Unmarshal(data[start:end], &msg)
+	return msg.Header
+}
+
+func (c *replayConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	return nil
+}
+
+func (c *replayConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.cond.Broadcast()
+	return nil
+}
@@ -0,0 +1,55 @@
+// Command jupyter-execute runs a notebook on a Jupyter server and saves the
+// outputs, like papermill without a python runtime. The server url and token
+// are discovered like api.CreateClient does unless given as flags.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/costrouc/go-jupyterlab-api/api"
+)
+
+func main() {
+	output := flag.String("output", "", "path on the server to save the executed notebook, defaults to overwriting the input")
+	kernel := flag.String("kernel", "", "kernelspec to use instead of the one in the notebook metadata")
+	allowErrors := flag.Bool("allow-errors", false, "keep executing cells after a cell raises an error")
+	timeout := flag.Duration("timeout", 0, "interrupt a cell running longer than this, 0 disables the limit")
+	url := flag.String("url", "", "jupyter server url")
+	token := flag.String("token", "", "jupyter server api token")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] notebook.ipynb\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var options []api.ClientOption
+	if *url != "" {
+		options = append(options, api.WithURL(*url))
+	}
+	client, err := api.CreateClient(&api.ClientConfig{ApiToken: *token}, options...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	_, err = client.ExecuteNotebook(ctx, flag.Arg(0), &api.ExecuteNotebookOptions{
+		OutputPath:  *output,
+		KernelName:  *kernel,
+		AllowErrors: *allowErrors,
+		CellTimeout: *timeout,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
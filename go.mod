@@ -1,3 +1,5 @@
 module github.com/costrouc/go-jupyterlab-api
 
 go 1.21.1
+
+require github.com/gorilla/websocket v1.5.3
@@ -0,0 +1,243 @@
+// Package hub is a client for the JupyterHub REST API used to manage users
+// and spawn their single-user servers, which are then used through package api.
+package hub
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/costrouc/go-jupyterlab-api/api"
+)
+
+func CreateClient(config *ClientConfig) (*ClientConfig, error) {
+	clientConfig := ClientConfig{
+		ApiToken:   config.ApiToken,
+		ApiURL:     config.ApiURL,
+		PublicURL:  config.PublicURL,
+		HTTPClient: config.HTTPClient,
+	}
+	if clientConfig.HTTPClient == nil {
+		clientConfig.HTTPClient = &http.Client{}
+	}
+
+	if clientConfig.ApiURL == "" {
+		clientConfig.ApiURL = os.Getenv("JUPYTERHUB_API_URL")
+	}
+	if clientConfig.ApiURL == "" {
+		clientConfig.ApiURL = "http://localhost:8000/hub/api"
+	}
+	clientConfig.ApiURL = strings.TrimSuffix(clientConfig.ApiURL, "/")
+	if clientConfig.PublicURL == "" {
+		clientConfig.PublicURL = os.Getenv("JUPYTERHUB_PUBLIC_URL")
+	}
+	clientConfig.PublicURL = strings.TrimSuffix(clientConfig.PublicURL, "/")
+
+	if clientConfig.ApiToken == "" {
+		apiToken, ok := os.LookupEnv("JUPYTERHUB_API_TOKEN")
+		if !ok {
+			return nil, errors.New("api token not defined can be set via JUPYTERHUB_API_TOKEN")
+		}
+		clientConfig.ApiToken = apiToken
+	}
+	return &clientConfig, nil
+}
+
+// publicURL is the url of the proxy in front of the hub which also routes
+// /user/{name}/ to single-user servers.
+func (c *ClientConfig) publicURL() string {
+	if c.PublicURL != "" {
+		return c.PublicURL
+	}
+	return strings.TrimSuffix(c.ApiURL, "/hub/api")
+}
+
+func (c *ClientConfig) do(ctx context.Context, method string, path string, requestBody []byte) (*http.Response, error) {
+	url := fmt.Sprintf("%s/%s", c.ApiURL, path)
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("token %s", c.ApiToken))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		apiErr := api.APIError{StatusCode: resp.StatusCode, Method: method, URL: url, Body: body}
+		_ = json.Unmarshal(body, &apiErr)
+		return nil, &apiErr
+	}
+	return resp, nil
+}
+
+func (c *ClientConfig) Request(ctx context.Context, method string, path string, requestBody []byte) ([]byte, error) {
+	resp, err := c.do(ctx, method, path, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func serverPath(user string, server string) string {
+	if server == "" {
+		return fmt.Sprintf("users/%s/server", url.PathEscape(user))
+	}
+	return fmt.Sprintf("users/%s/servers/%s", url.PathEscape(user), url.PathEscape(server))
+}
+
+func (c *ClientConfig) GetUsers(ctx context.Context) (*GetUsersResponse, error) {
+	data, err := c.Request(ctx, http.MethodGet, "users", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result GetUsersResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *ClientConfig) GetUser(ctx context.Context, user string) (*GetUserResponse, error) {
+	data, err := c.Request(ctx, http.MethodGet, fmt.Sprintf("users/%s", url.PathEscape(user)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result GetUserResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetTokenOwner returns the user or service that owns the api token along
+// with the scopes the token grants.
+func (c *ClientConfig) GetTokenOwner(ctx context.Context) (*GetTokenOwnerResponse, error) {
+	data, err := c.Request(ctx, http.MethodGet, "user", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result GetTokenOwnerResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// StartServer requests a spawn of the user's default server, or the named
+// server when server is not empty. It returns true when the server is ready
+// and false when the spawn is still pending.
+func (c *ClientConfig) StartServer(ctx context.Context, user string, server string, options StartServerBody) (bool, error) {
+	var body []byte
+	if options != nil {
+		var err error
+		body, err = json.Marshal(options)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, serverPath(user, server), body)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusCreated, nil
+}
+
+// StopServer returns true when the server has stopped and false when the
+// stop is still pending.
+func (c *ClientConfig) StopServer(ctx context.Context, user string, server string) (bool, error) {
+	resp, err := c.do(ctx, http.MethodDelete, serverPath(user, server), nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusNoContent, nil
+}
+
+// StreamProgress calls fn for each spawn progress event until the server is
+// ready, the spawn failed or fn returns an error.
+func (c *ClientConfig) StreamProgress(ctx context.Context, user string, server string, fn func(ProgressEvent) error) error {
+	resp, err := c.do(ctx, http.MethodGet, serverPath(user, server)+"/progress", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var event ProgressEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+		if event.Ready || event.Failed {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// ServerClient starts the user's server if needed, waits for the spawn to
+// finish and returns a client for the single-user server authenticated with
+// the hub token.
+func (c *ClientConfig) ServerClient(ctx context.Context, user string, server string, options ...api.ClientOption) (*api.ClientConfig, error) {
+	if _, err := c.StartServer(ctx, user, server, nil); err != nil && !api.IsBadRequest(err) {
+		// a 400 means the server is already running or pending
+		return nil, err
+	}
+
+	var ready ProgressEvent
+	err := c.StreamProgress(ctx, user, server, func(event ProgressEvent) error {
+		ready = event
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ready.Failed || !ready.Ready {
+		return nil, fmt.Errorf("spawning server for %s failed: %s", user, ready.Message)
+	}
+
+	options = append([]api.ClientOption{
+		api.WithHTTPClient(c.HTTPClient),
+		api.WithURL(c.publicURL() + ready.URL),
+		api.WithAuthenticator(&api.HubTokenAuthenticator{Token: c.ApiToken}),
+	}, options...)
+	return api.CreateClient(&api.ClientConfig{}, options...)
+}
@@ -0,0 +1,141 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/costrouc/go-jupyterlab-api/api"
+)
+
+func newTestHub(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Authorization") != "token hubtoken" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"status": 403, "message": "Missing or invalid credentials"}`))
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("/hub/api/users", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			w.Write([]byte(`[{"kind": "user", "name": "alice", "admin": false, "servers": {}}]`))
+		}
+	})
+	mux.HandleFunc("/hub/api/user", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			w.Write([]byte(`{"kind": "user", "name": "alice", "scopes": ["access:servers!user=alice"]}`))
+		}
+	})
+	mux.HandleFunc("/hub/api/users/alice/server", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) && r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+	mux.HandleFunc("/hub/api/users/alice/server/progress", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"progress\": 50, \"message\": \"Pulling image\"}\n\n")
+		fmt.Fprint(w, "data: {\"progress\": 100, \"ready\": true, \"message\": \"Server ready\", \"url\": \"/user/alice/\"}\n\n")
+	})
+	mux.HandleFunc("/user/alice/api/status", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			w.Write([]byte(`{"connections": 0, "kernels": 0}`))
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetUsersAndTokenOwner(t *testing.T) {
+	server := newTestHub(t)
+	client, err := CreateClient(&ClientConfig{ApiToken: "hubtoken", ApiURL: server.URL + "/hub/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	users, err := client.GetUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*users) != 1 || (*users)[0].Name != "alice" {
+		t.Errorf("Expected user alice, got %v", *users)
+	}
+
+	owner, err := client.GetTokenOwner(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.Name != "alice" || len(owner.Scopes) != 1 {
+		t.Errorf("Expected token owner alice with one scope, got %v", owner)
+	}
+
+	badClient, err := CreateClient(&ClientConfig{ApiToken: "wrong", ApiURL: server.URL + "/hub/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := badClient.GetUsers(ctx); !api.IsForbidden(err) {
+		t.Errorf("Expected forbidden error with an invalid token, got %v", err)
+	}
+}
+
+func TestServerClient(t *testing.T) {
+	t.Setenv("JUPYTERHUB_PUBLIC_URL", "")
+	server := newTestHub(t)
+	client, err := CreateClient(&ClientConfig{ApiToken: "hubtoken", ApiURL: server.URL + "/hub/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	ready, err := client.StartServer(ctx, "alice", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready {
+		t.Errorf("Expected spawn to be pending")
+	}
+
+	var events []ProgressEvent
+	err = client.StreamProgress(ctx, "alice", "", func(event ProgressEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || !events[1].Ready {
+		t.Errorf("Expected two progress events ending ready, got %v", events)
+	}
+
+	serverClient, err := client.ServerClient(ctx, "alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverClient.ApiURL != server.URL+"/user/alice/api" {
+		t.Errorf("Expected single-user api url, got %s", serverClient.ApiURL)
+	}
+	if _, err := serverClient.GetStatus(ctx); err != nil {
+		t.Errorf("Expected single-user server status with hub token, got %v", err)
+	}
+
+	// inside a hub deployment the api url is internal to the cluster
+	podClient, err := CreateClient(&ClientConfig{ApiToken: "hubtoken", ApiURL: server.URL + "/hub/api", PublicURL: "https://hub.example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverClient, err = podClient.ServerClient(ctx, "alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverClient.ApiURL != "https://hub.example.com/user/alice/api" {
+		t.Errorf("Expected single-user api url on the public url, got %s", serverClient.ApiURL)
+	}
+}
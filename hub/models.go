@@ -0,0 +1,62 @@
+package hub
+
+import (
+	"net/http"
+)
+
+type ClientConfig struct {
+	ApiToken string
+	ApiURL   string
+	// PublicURL is the proxy url routing /user/{name}/ to single-user
+	// servers, derived from ApiURL when empty. It differs from ApiURL
+	// inside a hub deployment where the api is reached on an internal
+	// address such as http://hub:8081/hub/api.
+	PublicURL  string
+	HTTPClient *http.Client
+}
+
+type Server struct {
+	Name         string                 `json:"name"`
+	Ready        bool                   `json:"ready"`
+	Stopped      bool                   `json:"stopped"`
+	Pending      string                 `json:"pending"` // spawn, stop or empty
+	URL          string                 `json:"url"`
+	ProgressURL  string                 `json:"progress_url"`
+	Started      string                 `json:"started"`
+	LastActivity string                 `json:"last_activity"`
+	State        map[string]interface{} `json:"state"`
+	UserOptions  map[string]interface{} `json:"user_options"`
+}
+
+type User struct {
+	Kind         string            `json:"kind"`
+	Name         string            `json:"name"`
+	Admin        bool              `json:"admin"`
+	Roles        []string          `json:"roles"`
+	Groups       []string          `json:"groups"`
+	Server       string            `json:"server"`
+	Pending      string            `json:"pending"`
+	Created      string            `json:"created"`
+	LastActivity string            `json:"last_activity"`
+	Servers      map[string]Server `json:"servers"`
+	// only returned by GetTokenOwner
+	Scopes    []string `json:"scopes"`
+	SessionId string   `json:"session_id"`
+}
+
+type GetUsersResponse []User
+
+type GetUserResponse User
+
+type GetTokenOwnerResponse User
+
+type StartServerBody map[string]interface{}
+
+type ProgressEvent struct {
+	Progress    int    `json:"progress"`
+	Message     string `json:"message"`
+	Ready       bool   `json:"ready"`
+	Failed      bool   `json:"failed"`
+	URL         string `json:"url"`
+	HTMLMessage string `json:"html_message"`
+}
@@ -0,0 +1,329 @@
+package jupytertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/costrouc/go-jupyterlab-api/api"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	kernelProtocolVersion = "5.3"
+	waitForInterrupt      = "jupytertest_wait_for_interrupt"
+)
+
+// KernelOutput is a message published on iopub while executing code.
+type KernelOutput struct {
+	MsgType string
+	Content interface{}
+}
+
+// ExecuteFunc returns the outputs of the code of an execute_request.
+type ExecuteFunc func(code string) []KernelOutput
+
+func Stream(name string, text string) KernelOutput {
+	return KernelOutput{MsgType: "stream", Content: api.StreamContent{Name: name, Text: text}}
+}
+
+// DisplayData publishes data, a non empty displayId allows later updates
+// with UpdateDisplayData.
+func DisplayData(displayId string, data map[string]interface{}) KernelOutput {
+	return KernelOutput{MsgType: "display_data", Content: displayContent(displayId, data)}
+}
+
+func UpdateDisplayData(displayId string, data map[string]interface{}) KernelOutput {
+	return KernelOutput{MsgType: "update_display_data", Content: displayContent(displayId, data)}
+}
+
+func displayContent(displayId string, data map[string]interface{}) api.DisplayDataContent {
+	content := api.DisplayDataContent{Data: data, Metadata: map[string]interface{}{}, Transient: map[string]interface{}{}}
+	if displayId != "" {
+		content.Transient["display_id"] = displayId
+	}
+	return content
+}
+
+// ExecuteResult publishes data with the execution count of the request.
+func ExecuteResult(data map[string]interface{}) KernelOutput {
+	return KernelOutput{MsgType: "execute_result", Content: api.ExecuteResultContent{Data: data, Metadata: map[string]interface{}{}}}
+}
+
+func ClearOutput(wait bool) KernelOutput {
+	return KernelOutput{MsgType: "clear_output", Content: api.ClearOutputContent{Wait: wait}}
+}
+
+// Error fails the execution, outputs after it are not published.
+func Error(ename string, evalue string, traceback ...string) KernelOutput {
+	if len(traceback) == 0 {
+		traceback = []string{fmt.Sprintf("%s: %s", ename, evalue)}
+	}
+	return KernelOutput{MsgType: "error", Content: api.ErrorContent{Ename: ename, Evalue: evalue, Traceback: traceback}}
+}
+
+// WaitForInterrupt blocks the execution until the kernel is interrupted,
+// which fails it with a KeyboardInterrupt, or restarted.
+func WaitForInterrupt() KernelOutput {
+	return KernelOutput{MsgType: waitForInterrupt}
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type channelsConn struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	closed  chan struct{}
+}
+
+func (c *channelsConn) send(msg *api.KernelMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.conn.WriteJSON(msg)
+}
+
+func (s *Server) handleChannels(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	k, ok := s.kernels[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Kernel does not exist: %s", id))
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &channelsConn{conn: conn, closed: make(chan struct{})}
+	s.mu.Lock()
+	k.conns[c] = struct{}{}
+	s.mu.Unlock()
+
+	// shell requests are handled in order while control requests, such as
+	// interrupts, are answered immediately
+	shell := make(chan *api.KernelMessage, 64)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range shell {
+			s.handleShell(k, c, msg)
+		}
+	}()
+	defer func() {
+		s.mu.Lock()
+		delete(k.conns, c)
+		s.mu.Unlock()
+		conn.Close()
+		close(c.closed)
+		close(shell)
+		<-done
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+		var msg api.KernelMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		switch msg.Channel {
+		case "shell":
+			shell <- &msg
+		case "control":
+			s.handleControl(k, c, &msg)
+		}
+	}
+}
+
+func (k *kernel) message(channel string, msgType string, parent api.KernelMessageHeader, content interface{}) *api.KernelMessage {
+	data, _ := json.Marshal(content)
+	return &api.KernelMessage{
+		Channel: channel,
+		Header: api.KernelMessageHeader{
+			MsgId:    newUUID(),
+			MsgType:  msgType,
+			Username: "jupytertest",
+			Session:  k.session,
+			Date:     time.Now().UTC().Format(time.RFC3339Nano),
+			Version:  kernelProtocolVersion,
+		},
+		ParentHeader: parent,
+		Metadata:     map[string]interface{}{},
+		Content:      data,
+	}
+}
+
+// publish broadcasts an iopub message to every connection of the kernel.
+func (s *Server) publish(k *kernel, parent *api.KernelMessage, msgType string, content interface{}) {
+	msg := k.message("iopub", msgType, parent.Header, content)
+	s.mu.Lock()
+	conns := make([]*channelsConn, 0, len(k.conns))
+	for c := range k.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.send(msg)
+	}
+}
+
+func (s *Server) setExecutionState(k *kernel, parent *api.KernelMessage, state string) {
+	s.mu.Lock()
+	k.model.ExecutionState = state
+	k.model.LastActivity = timestamp(time.Now())
+	s.mu.Unlock()
+	s.publish(k, parent, "status", api.KernelStatusContent{ExecutionState: state})
+}
+
+func kernelInfo() api.KernelInfoReplyContent {
+	return api.KernelInfoReplyContent{
+		Status:                "ok",
+		ProtocolVersion:       kernelProtocolVersion,
+		Implementation:        "jupytertest",
+		ImplementationVersion: DefaultVersion,
+		LanguageInfo: map[string]interface{}{
+			"name":               "python",
+			"version":            "3.12.0",
+			"mimetype":           "text/x-python",
+			"file_extension":     ".py",
+			"pygments_lexer":     "ipython3",
+			"codemirror_mode":    map[string]interface{}{"name": "ipython", "version": 3},
+			"nbconvert_exporter": "python",
+		},
+		Banner: "jupytertest scripted kernel",
+	}
+}
+
+func (s *Server) handleShell(k *kernel, c *channelsConn, msg *api.KernelMessage) {
+	k.execMu.Lock()
+	defer k.execMu.Unlock()
+
+	switch msg.Header.MsgType {
+	case "kernel_info_request":
+		s.setExecutionState(k, msg, "busy")
+		c.send(k.message("shell", "kernel_info_reply", msg.Header, kernelInfo()))
+		s.setExecutionState(k, msg, "idle")
+	case "execute_request":
+		s.setExecutionState(k, msg, "busy")
+		if reply, ok := s.execute(k, c, msg); ok {
+			c.send(k.message("shell", "execute_reply", msg.Header, reply))
+		}
+		s.setExecutionState(k, msg, "idle")
+	}
+}
+
+func (s *Server) execute(k *kernel, c *channelsConn, msg *api.KernelMessage) (map[string]interface{}, bool) {
+	var request api.ExecuteRequestContent
+	if err := json.Unmarshal(msg.Content, &request); err != nil {
+		return map[string]interface{}{"status": "error", "ename": "ValueError", "evalue": err.Error(), "traceback": []string{}}, true
+	}
+
+	signal := make(chan bool, 1)
+	s.mu.Lock()
+	if request.StoreHistory && !request.Silent {
+		k.executionCount++
+	}
+	count := k.executionCount
+	execute := s.Execute
+	k.signal = signal
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		k.signal = nil
+		s.mu.Unlock()
+	}()
+
+	if !request.Silent {
+		s.publish(k, msg, "execute_input", map[string]interface{}{"code": request.Code, "execution_count": count})
+	}
+	var outputs []KernelOutput
+	if execute != nil {
+		outputs = execute(request.Code)
+	}
+
+	reply := map[string]interface{}{
+		"status":           "ok",
+		"execution_count":  count,
+		"user_expressions": map[string]interface{}{},
+		"payload":          []interface{}{},
+	}
+	for _, output := range outputs {
+		if output.MsgType == waitForInterrupt {
+			if !waitForSignal(signal, c) {
+				// a restarted kernel never replies to the request
+				return nil, false
+			}
+			output = Error("KeyboardInterrupt", "")
+		}
+		if result, ok := output.Content.(api.ExecuteResultContent); ok {
+			result.ExecutionCount = count
+			output.Content = result
+		}
+		if !request.Silent {
+			s.publish(k, msg, output.MsgType, output.Content)
+		}
+
+		if output.MsgType == "error" {
+			var failure api.ErrorContent
+			data, _ := json.Marshal(output.Content)
+			_ = json.Unmarshal(data, &failure)
+			reply = map[string]interface{}{
+				"status":          "error",
+				"execution_count": count,
+				"ename":           failure.Ename,
+				"evalue":          failure.Evalue,
+				"traceback":       failure.Traceback,
+			}
+			break
+		}
+	}
+	return reply, true
+}
+
+// waitForSignal reports true when the kernel was interrupted and false
+// when it was restarted, shut down or the connection closed.
+func waitForSignal(signal chan bool, c *channelsConn) bool {
+	select {
+	case interrupted := <-signal:
+		return interrupted
+	case <-c.closed:
+		return false
+	}
+}
+
+func (s *Server) handleControl(k *kernel, c *channelsConn, msg *api.KernelMessage) {
+	switch msg.Header.MsgType {
+	case "kernel_info_request":
+		c.send(k.message("control", "kernel_info_reply", msg.Header, kernelInfo()))
+	case "interrupt_request":
+		s.mu.Lock()
+		k.sendSignal(true)
+		s.mu.Unlock()
+		c.send(k.message("control", "interrupt_reply", msg.Header, map[string]interface{}{"status": "ok"}))
+	case "shutdown_request":
+		var request struct {
+			Restart bool `json:"restart"`
+		}
+		_ = json.Unmarshal(msg.Content, &request)
+		c.send(k.message("control", "shutdown_reply", msg.Header, map[string]interface{}{"status": "ok", "restart": request.Restart}))
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if request.Restart {
+			k.restart()
+			return
+		}
+		s.deleteKernel(k.model.Id)
+	}
+}
@@ -0,0 +1,491 @@
+package jupytertest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// the file checkpoint manager of jupyter_server keeps a single checkpoint
+const checkpointId = "checkpoint"
+
+type checkpoint struct {
+	lastModified time.Time
+	data         []byte
+}
+
+type contentModel struct {
+	Name          string      `json:"name"`
+	Path          string      `json:"path"`
+	LastModified  string      `json:"last_modified"`
+	Created       string      `json:"created"`
+	Content       interface{} `json:"content"`
+	Format        interface{} `json:"format"`
+	Mimetype      interface{} `json:"mimetype"`
+	Size          interface{} `json:"size"`
+	Writable      bool        `json:"writable"`
+	Type          string      `json:"type"`
+	Hash          interface{} `json:"hash,omitempty"`
+	HashAlgorithm interface{} `json:"hash_algorithm,omitempty"`
+}
+
+type saveModel struct {
+	Type    string          `json:"type"`
+	Format  string          `json:"format"`
+	Content json.RawMessage `json:"content"`
+	Chunk   int             `json:"chunk"`
+}
+
+type createModel struct {
+	CopyFrom string `json:"copy_from"`
+	Ext      string `json:"ext"`
+	Type     string `json:"type"`
+}
+
+func (s *Server) osPath(p string) string {
+	clean := path.Clean("/" + p)
+	return filepath.Join(s.Root, filepath.FromSlash(clean))
+}
+
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+func (s *Server) handleContents(w http.ResponseWriter, r *http.Request, p string) {
+	if strings.HasSuffix(p, "/checkpoints") || strings.Contains(p, "/checkpoints/") || p == "checkpoints" {
+		i := strings.LastIndex(p, "checkpoints")
+		s.handleCheckpoints(w, r, strings.Trim(p[:i], "/"), strings.Trim(p[i+len("checkpoints"):], "/"))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		s.getContents(w, r, p)
+	case http.MethodPost:
+		s.createContents(w, r, p)
+	case http.MethodPut:
+		s.saveContents(w, r, p)
+	case http.MethodPatch:
+		s.renameContents(w, r, p)
+	case http.MethodDelete:
+		s.deleteContents(w, p)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// model builds the contents model for p, including content when requested
+// in the given type and format.
+func (s *Server) model(p string, withContent bool, typ string, format string, hash bool) (*contentModel, int, error) {
+	osPath := s.osPath(p)
+	info, err := os.Stat(osPath)
+	if err != nil {
+		return nil, http.StatusNotFound, fmt.Errorf("No such file or directory: %s", p)
+	}
+
+	model := contentModel{
+		Name:         path.Base("/" + p),
+		Path:         p,
+		LastModified: timestamp(info.ModTime()),
+		Created:      timestamp(info.ModTime()),
+		Writable:     true,
+	}
+	if p == "" {
+		model.Name = ""
+	}
+
+	switch {
+	case info.IsDir():
+		if typ != "" && typ != "directory" {
+			return nil, http.StatusBadRequest, fmt.Errorf("%s is a directory, not a %s", p, typ)
+		}
+		model.Type = "directory"
+		model.Size = nil
+		if withContent {
+			entries, err := os.ReadDir(osPath)
+			if err != nil {
+				return nil, http.StatusInternalServerError, err
+			}
+			children := []*contentModel{}
+			for _, entry := range entries {
+				if isHidden(entry.Name()) {
+					continue
+				}
+				child, _, err := s.model(path.Join(p, entry.Name()), false, "", "", false)
+				if err != nil {
+					continue
+				}
+				children = append(children, child)
+			}
+			model.Content = children
+			model.Format = "json"
+		}
+		return &model, http.StatusOK, nil
+	case typ == "directory":
+		return nil, http.StatusBadRequest, fmt.Errorf("%s is not a directory", p)
+	}
+
+	model.Size = info.Size()
+	data, err := os.ReadFile(osPath)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if hash {
+		sum := sha256.Sum256(data)
+		model.Hash = hex.EncodeToString(sum[:])
+		model.HashAlgorithm = "sha256"
+	}
+
+	if typ == "notebook" || (typ == "" && strings.HasSuffix(p, ".ipynb")) {
+		model.Type = "notebook"
+		if withContent {
+			var notebook map[string]interface{}
+			if err := json.Unmarshal(data, &notebook); err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("Unreadable Notebook: %s %v", p, err)
+			}
+			model.Content = notebook
+			model.Format = "json"
+		}
+		return &model, http.StatusOK, nil
+	}
+
+	model.Type = "file"
+	model.Mimetype = mime.TypeByExtension(path.Ext(p))
+	if withContent {
+		switch {
+		case format == "base64" || (format == "" && !utf8.Valid(data)):
+			model.Content = base64.StdEncoding.EncodeToString(data)
+			model.Format = "base64"
+			if model.Mimetype == "" {
+				model.Mimetype = "application/octet-stream"
+			}
+		case format == "text" || format == "":
+			if !utf8.Valid(data) {
+				return nil, http.StatusBadRequest, fmt.Errorf("%s is not UTF-8 encoded", p)
+			}
+			model.Content = string(data)
+			model.Format = "text"
+			if model.Mimetype == "" {
+				model.Mimetype = "text/plain"
+			}
+		default:
+			return nil, http.StatusBadRequest, fmt.Errorf("Format %s is invalid", format)
+		}
+	}
+	return &model, http.StatusOK, nil
+}
+
+func (s *Server) getContents(w http.ResponseWriter, r *http.Request, p string) {
+	query := r.URL.Query()
+	withContent := query.Get("content") != "0"
+	hash := query.Get("hash") == "1"
+	model, status, err := s.model(p, withContent, query.Get("type"), query.Get("format"), hash)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, model)
+}
+
+// untitledName follows the naming of jupyter_server: untitled.txt,
+// untitled1.txt for files and Untitled Folder, Untitled Folder 1 for
+// directories.
+func (s *Server) untitledName(dir string, base string, ext string, sep string) string {
+	for i := 0; ; i++ {
+		name := base + ext
+		if i > 0 {
+			name = fmt.Sprintf("%s%s%d%s", base, sep, i, ext)
+		}
+		if _, err := os.Stat(s.osPath(path.Join(dir, name))); os.IsNotExist(err) {
+			return name
+		}
+	}
+}
+
+func (s *Server) createContents(w http.ResponseWriter, r *http.Request, dir string) {
+	var body createModel
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON in body of request")
+			return
+		}
+	}
+	if info, err := os.Stat(s.osPath(dir)); err != nil || !info.IsDir() {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No such directory: %s", dir))
+		return
+	}
+
+	var name string
+	var data []byte
+	switch {
+	case body.CopyFrom != "":
+		source, err := os.ReadFile(s.osPath(body.CopyFrom))
+		if err != nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("No such file: %s", body.CopyFrom))
+			return
+		}
+		ext := path.Ext(body.CopyFrom)
+		base := strings.TrimSuffix(path.Base(body.CopyFrom), ext)
+		for i := 1; ; i++ {
+			name = fmt.Sprintf("%s-Copy%d%s", base, i, ext)
+			if _, err := os.Stat(s.osPath(path.Join(dir, name))); os.IsNotExist(err) {
+				break
+			}
+		}
+		data = source
+	case body.Type == "directory":
+		name = s.untitledName(dir, "Untitled Folder", "", " ")
+		if err := os.Mkdir(s.osPath(path.Join(dir, name)), 0o755); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	case body.Type == "notebook" || body.Ext == ".ipynb":
+		name = s.untitledName(dir, "Untitled", ".ipynb", "")
+		data = []byte("{\n \"cells\": [],\n \"metadata\": {},\n \"nbformat\": 4,\n \"nbformat_minor\": 5\n}\n")
+	default:
+		name = s.untitledName(dir, "untitled", body.Ext, "")
+	}
+
+	p := path.Join(dir, name)
+	if body.Type != "directory" || body.CopyFrom != "" {
+		if err := os.WriteFile(s.osPath(p), data, 0o644); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	model, status, err := s.model(p, false, "", "", false)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/api/contents/"+p)
+	writeJSON(w, http.StatusCreated, model)
+}
+
+func decodeFileContent(body *saveModel) ([]byte, error) {
+	var content string
+	if err := json.Unmarshal(body.Content, &content); err != nil {
+		return nil, fmt.Errorf("No file content provided")
+	}
+	switch body.Format {
+	case "text":
+		return []byte(content), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(strings.ReplaceAll(content, "\n", ""))
+	}
+	return nil, fmt.Errorf("Must specify format of file contents as 'text' or 'base64'")
+}
+
+func (s *Server) saveContents(w http.ResponseWriter, r *http.Request, p string) {
+	var body saveModel
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON in body of request")
+		return
+	}
+	osPath := s.osPath(p)
+	_, statErr := os.Stat(osPath)
+	status := http.StatusOK
+	if os.IsNotExist(statErr) {
+		status = http.StatusCreated
+	}
+	if _, err := os.Stat(filepath.Dir(osPath)); err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No such directory: %s", path.Dir(p)))
+		return
+	}
+
+	switch body.Type {
+	case "directory":
+		if err := os.MkdirAll(osPath, 0o755); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	case "notebook":
+		var notebook map[string]interface{}
+		if err := json.Unmarshal(body.Content, &notebook); err != nil || notebook == nil {
+			writeError(w, http.StatusBadRequest, "Unexpected error while saving file: invalid notebook")
+			return
+		}
+		data, err := json.MarshalIndent(notebook, "", " ")
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if err := os.WriteFile(osPath, append(data, '\n'), 0o644); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	case "file":
+		data, err := decodeFileContent(&body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if body.Chunk != 0 && body.Chunk != 1 {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		f, err := os.OpenFile(osPath, flags, 0o644)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "No file type provided")
+		return
+	}
+
+	model, modelStatus, err := s.model(p, false, "", "", false)
+	if err != nil {
+		writeError(w, modelStatus, err.Error())
+		return
+	}
+	writeJSON(w, status, model)
+}
+
+func (s *Server) renameContents(w http.ResponseWriter, r *http.Request, p string) {
+	var body struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Path == "" {
+		writeError(w, http.StatusBadRequest, "Invalid JSON in body of request")
+		return
+	}
+	newPath := strings.Trim(body.Path, "/")
+	if _, err := os.Stat(s.osPath(p)); err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No such file or directory: %s", p))
+		return
+	}
+	if _, err := os.Stat(s.osPath(newPath)); err == nil {
+		writeError(w, http.StatusConflict, fmt.Sprintf("File already exists: %s", newPath))
+		return
+	}
+	if err := os.Rename(s.osPath(p), s.osPath(newPath)); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if cp, ok := s.checkpoints[p]; ok {
+		delete(s.checkpoints, p)
+		s.checkpoints[newPath] = cp
+	}
+
+	model, status, err := s.model(newPath, false, "", "", false)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, model)
+}
+
+func (s *Server) deleteContents(w http.ResponseWriter, p string) {
+	if p == "" {
+		writeError(w, http.StatusBadRequest, "Cannot delete root directory")
+		return
+	}
+	if _, err := os.Stat(s.osPath(p)); err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("File or directory does not exist: %s", p))
+		return
+	}
+	if err := os.RemoveAll(s.osPath(p)); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	delete(s.checkpoints, p)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleCheckpoints(w http.ResponseWriter, r *http.Request, p string, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	osPath := s.osPath(p)
+	if info, err := os.Stat(osPath); err != nil || info.IsDir() {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No such file: %s", p))
+		return
+	}
+	cp := s.checkpoints[p]
+	model := func(cp *checkpoint) map[string]string {
+		return map[string]string{"id": checkpointId, "last_modified": timestamp(cp.lastModified)}
+	}
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		checkpoints := []map[string]string{}
+		if cp != nil {
+			checkpoints = append(checkpoints, model(cp))
+		}
+		writeJSON(w, http.StatusOK, checkpoints)
+	case id == "" && r.Method == http.MethodPost:
+		data, err := os.ReadFile(osPath)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		cp = &checkpoint{lastModified: time.Now(), data: data}
+		s.checkpoints[p] = cp
+		w.Header().Set("Location", fmt.Sprintf("/api/contents/%s/checkpoints/%s", p, checkpointId))
+		writeJSON(w, http.StatusCreated, model(cp))
+	case id != "" && (cp == nil || id != checkpointId):
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Checkpoint does not exist: %s@%s", p, id))
+	case r.Method == http.MethodPost:
+		if err := os.WriteFile(osPath, cp.data, 0o644); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(s.checkpoints, p)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request, p string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w)
+		return
+	}
+	osPath := s.osPath(p)
+	info, err := os.Stat(osPath)
+	if err != nil || info.IsDir() || isHidden(path.Base(p)) {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	http.ServeFile(w, r, osPath)
+}
+
+// Files returns the slash separated paths of every file under Root, which is
+// handy for asserting on the state of the contents api.
+func (s *Server) Files() []string {
+	var files []string
+	filepath.WalkDir(s.Root, func(p string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(s.Root, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,391 @@
+package jupytertest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/costrouc/go-jupyterlab-api/api"
+)
+
+const DefaultKernelSpec = "python3"
+
+var kernelSpecs = map[string]api.KernelSpec{
+	DefaultKernelSpec: {
+		Name: DefaultKernelSpec,
+		Spec: api.KernelSpecFile{
+			Argv:          []string{"python", "-m", "ipykernel_launcher", "-f", "{connection_file}"},
+			DisplayName:   "Python 3 (ipykernel)",
+			Language:      "python",
+			InterruptMode: "signal",
+			Env:           map[string]string{},
+			Metadata:      map[string]interface{}{"debugger": true},
+		},
+		Resources: map[string]string{
+			"logo-32x32": "/kernelspecs/python3/logo-32x32.png",
+			"logo-64x64": "/kernelspecs/python3/logo-64x64.png",
+		},
+	},
+}
+
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func (s *Server) handleKernelSpecs(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	if name == "" {
+		writeJSON(w, http.StatusOK, api.GetKernelSpecsResponse{Default: DefaultKernelSpec, KernelSpecs: kernelSpecs})
+		return
+	}
+	spec, ok := kernelSpecs[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Kernel spec %s not found", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, spec)
+}
+
+func (s *Server) handleKernelSpecResource(w http.ResponseWriter, r *http.Request, p string) {
+	name, file, _ := strings.Cut(p, "/")
+	if _, ok := kernelSpecs[name]; !ok || !strings.HasPrefix(file, "logo-") || !strings.HasSuffix(file, ".png") {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	size, err := strconv.Atoi(strings.SplitN(strings.TrimPrefix(file, "logo-"), "x", 2)[0])
+	if err != nil || size <= 0 || size > 512 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	logo := image.NewRGBA(image.Rect(0, 0, size, size))
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			logo.Set(x, y, color.RGBA{R: 0x30, G: 0x69, B: 0x98, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, logo)
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
+
+type kernel struct {
+	model   api.Kernel
+	session string
+
+	// execMu serializes execute requests like the shell channel of a kernel
+	execMu         sync.Mutex
+	executionCount int
+	conns          map[*channelsConn]struct{}
+	// signal is set while executing, it receives true on interrupt and
+	// false on restart and holds one signal until the execution waits for it
+	signal chan bool
+}
+
+// startKernel must be called with s.mu held.
+func (s *Server) startKernel(name string) (*kernel, error) {
+	if name == "" {
+		name = DefaultKernelSpec
+	}
+	if _, ok := kernelSpecs[name]; !ok {
+		return nil, fmt.Errorf("No such kernel named %s", name)
+	}
+	k := &kernel{
+		model: api.Kernel{
+			Id:             newUUID(),
+			Name:           name,
+			LastActivity:   timestamp(time.Now()),
+			ExecutionState: "idle",
+		},
+		session: newUUID(),
+		conns:   map[*channelsConn]struct{}{},
+	}
+	s.kernels[k.model.Id] = k
+	return k, nil
+}
+
+// kernelModel must be called with s.mu held.
+func (k *kernel) kernelModel() api.Kernel {
+	model := k.model
+	model.Connections = len(k.conns)
+	return model
+}
+
+// sendSignal must be called with s.mu held.
+func (k *kernel) sendSignal(interrupt bool) {
+	if k.signal == nil {
+		return
+	}
+	if !interrupt {
+		// a restart wins over a pending interrupt
+		select {
+		case <-k.signal:
+		default:
+		}
+	}
+	select {
+	case k.signal <- interrupt:
+	default:
+	}
+}
+
+func (s *Server) handleKernels(w http.ResponseWriter, r *http.Request, p string) {
+	id, action, _ := strings.Cut(p, "/")
+	if action == "channels" {
+		s.handleChannels(w, r, id)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			kernels := []api.Kernel{}
+			for _, k := range s.kernels {
+				kernels = append(kernels, k.kernelModel())
+			}
+			writeJSON(w, http.StatusOK, kernels)
+		case http.MethodPost:
+			var body api.CreateKernelBody
+			if r.ContentLength != 0 {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					writeError(w, http.StatusBadRequest, "Invalid JSON in body of request")
+					return
+				}
+			}
+			k, err := s.startKernel(body.Name)
+			if err != nil {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			w.Header().Set("Location", "/api/kernels/"+k.model.Id)
+			writeJSON(w, http.StatusCreated, k.kernelModel())
+		default:
+			methodNotAllowed(w)
+		}
+		return
+	}
+
+	k, ok := s.kernels[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Kernel does not exist: %s", id))
+		return
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, k.kernelModel())
+	case action == "" && r.Method == http.MethodDelete:
+		s.deleteKernel(id)
+		w.WriteHeader(http.StatusNoContent)
+	case action == "interrupt" && r.Method == http.MethodPost:
+		k.sendSignal(true)
+		w.WriteHeader(http.StatusNoContent)
+	case action == "restart" && r.Method == http.MethodPost:
+		k.restart()
+		writeJSON(w, http.StatusOK, k.kernelModel())
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// restart must be called with s.mu held.
+func (k *kernel) restart() {
+	k.sendSignal(false)
+	k.executionCount = 0
+	k.model.ExecutionState = "idle"
+	k.model.LastActivity = timestamp(time.Now())
+}
+
+// deleteKernel must be called with s.mu held.
+func (s *Server) deleteKernel(id string) {
+	k, ok := s.kernels[id]
+	if !ok {
+		return
+	}
+	k.sendSignal(false)
+	for c := range k.conns {
+		c.conn.Close()
+	}
+	delete(s.kernels, id)
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			sessions := []api.Session{}
+			for _, session := range s.sessions {
+				sessions = append(sessions, s.sessionModel(session))
+			}
+			writeJSON(w, http.StatusOK, sessions)
+		case http.MethodPost:
+			s.createSession(w, r)
+		default:
+			methodNotAllowed(w)
+		}
+		return
+	}
+
+	session, ok := s.sessions[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Session not found: session_id=%s", id))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.sessionModel(session))
+	case http.MethodPatch:
+		var body api.PatchSessionBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON in body of request")
+			return
+		}
+		if body.Path != "" {
+			session.Path = body.Path
+		}
+		if body.Name != "" {
+			session.Name = body.Name
+		}
+		if body.Type != "" {
+			session.Type = body.Type
+		}
+		if body.Kernel != nil {
+			k, err := s.sessionKernel(*body.Kernel)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			session.Kernel = k.kernelModel()
+		}
+		writeJSON(w, http.StatusOK, s.sessionModel(session))
+	case http.MethodDelete:
+		delete(s.sessions, id)
+		s.deleteKernel(session.Kernel.Id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// sessionModel refreshes the kernel model of a session, must be called with
+// s.mu held.
+func (s *Server) sessionModel(session *api.Session) api.Session {
+	model := *session
+	if k, ok := s.kernels[session.Kernel.Id]; ok {
+		model.Kernel = k.kernelModel()
+	}
+	return model
+}
+
+// sessionKernel must be called with s.mu held.
+func (s *Server) sessionKernel(selected api.SessionKernel) (*kernel, error) {
+	if selected.Id != "" {
+		k, ok := s.kernels[selected.Id]
+		if !ok {
+			return nil, fmt.Errorf("Kernel does not exist: %s", selected.Id)
+		}
+		return k, nil
+	}
+	return s.startKernel(selected.Name)
+}
+
+func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
+	var body api.CreateSessionBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON in body of request")
+		return
+	}
+	if body.Path == "" {
+		writeError(w, http.StatusBadRequest, "Missing field in JSON data: path")
+		return
+	}
+	if body.Type == "" {
+		writeError(w, http.StatusBadRequest, "Missing field in JSON data: type")
+		return
+	}
+
+	// like jupyter_server an existing session for the path is returned
+	for _, session := range s.sessions {
+		if session.Path == body.Path {
+			writeJSON(w, http.StatusCreated, s.sessionModel(session))
+			return
+		}
+	}
+
+	k, err := s.sessionKernel(body.Kernel)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	session := &api.Session{
+		Id:     newUUID(),
+		Path:   body.Path,
+		Name:   body.Name,
+		Type:   body.Type,
+		Kernel: k.kernelModel(),
+	}
+	s.sessions[session.Id] = session
+	w.Header().Set("Location", "/api/sessions/"+session.Id)
+	writeJSON(w, http.StatusCreated, s.sessionModel(session))
+}
+
+func (s *Server) handleTerminals(w http.ResponseWriter, r *http.Request, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name == "" {
+		switch r.Method {
+		case http.MethodGet:
+			terminals := []api.Terminal{}
+			for _, terminal := range s.terminals {
+				terminals = append(terminals, *terminal)
+			}
+			writeJSON(w, http.StatusOK, terminals)
+		case http.MethodPost:
+			s.terminalSeq++
+			terminal := &api.Terminal{Name: strconv.Itoa(s.terminalSeq), LastActivity: timestamp(time.Now())}
+			s.terminals[terminal.Name] = terminal
+			writeJSON(w, http.StatusOK, terminal)
+		default:
+			methodNotAllowed(w)
+		}
+		return
+	}
+
+	terminal, ok := s.terminals[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Terminal not found: %s", name))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, terminal)
+	case http.MethodDelete:
+		delete(s.terminals, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w)
+	}
+}
@@ -0,0 +1,256 @@
+// Package jupytertest provides an in-process fake Jupyter server for testing
+// code built on package api without a running JupyterLab. It implements the
+// contents, checkpoints, sessions, kernels, kernelspecs, terminals, config,
+// status and version endpoints with the same json shapes as jupyter_server,
+// along with scripted kernels on the kernel channels websocket.
+package jupytertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/costrouc/go-jupyterlab-api/api"
+)
+
+const (
+	DefaultToken   = "faketoken"
+	DefaultVersion = "2.14.0"
+)
+
+type Server struct {
+	// URL is the root of the server, the api is served under URL/api
+	URL   string
+	Token string
+	// Root is the temporary directory backing the contents api
+	Root string
+	// Execute scripts the kernels, it returns the outputs published for the
+	// code of each execute_request. Kernels produce no output when it is nil.
+	Execute ExecuteFunc
+
+	server  *httptest.Server
+	started time.Time
+
+	mu           sync.Mutex
+	lastActivity time.Time
+	checkpoints  map[string]*checkpoint
+	sessions     map[string]*api.Session
+	kernels      map[string]*kernel
+	terminals    map[string]*api.Terminal
+	terminalSeq  int
+	config       map[string]map[string]interface{}
+}
+
+// NewServer starts a fake server accepting DefaultToken with contents backed
+// by a new temporary directory. Call Close to stop it and remove the files.
+func NewServer() *Server {
+	root, err := os.MkdirTemp("", "jupytertest-")
+	if err != nil {
+		panic(fmt.Sprintf("jupytertest: creating contents root: %v", err))
+	}
+
+	now := time.Now().UTC()
+	s := &Server{
+		Token:        DefaultToken,
+		Root:         root,
+		started:      now,
+		lastActivity: now,
+		checkpoints:  map[string]*checkpoint{},
+		sessions:     map[string]*api.Session{},
+		kernels:      map[string]*kernel{},
+		terminals:    map[string]*api.Terminal{},
+		config:       map[string]map[string]interface{}{},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.ServeHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.mu.Lock()
+	for id := range s.kernels {
+		s.deleteKernel(id)
+	}
+	s.mu.Unlock()
+	s.server.Close()
+	os.RemoveAll(s.Root)
+}
+
+// Client returns a client for the server authenticated with its token.
+func (s *Server) Client(options ...api.ClientOption) (*api.ClientConfig, error) {
+	options = append([]api.ClientOption{api.WithURL(s.URL)}, options...)
+	return api.CreateClient(&api.ClientConfig{ApiToken: s.Token}, options...)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	authorization := r.Header.Get("Authorization")
+	for _, scheme := range []string{"token ", "Bearer "} {
+		if strings.HasPrefix(authorization, scheme) && strings.TrimPrefix(authorization, scheme) == s.Token {
+			return true
+		}
+	}
+	return r.URL.Query().Get("token") == s.Token
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+	s.mu.Lock()
+	s.lastActivity = time.Now().UTC()
+	s.mu.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case path == "/api" || path == "/api/":
+		writeJSON(w, http.StatusOK, map[string]string{"version": DefaultVersion})
+	case path == "/api/status":
+		s.handleStatus(w, r)
+	case path == "/api/me":
+		s.handleMe(w, r)
+	case strings.HasPrefix(path, "/api/contents"):
+		s.handleContents(w, r, trimPath(path, "/api/contents"))
+	case strings.HasPrefix(path, "/files/"):
+		s.handleFiles(w, r, trimPath(path, "/files"))
+	case strings.HasPrefix(path, "/api/sessions"):
+		s.handleSessions(w, r, trimPath(path, "/api/sessions"))
+	case strings.HasPrefix(path, "/api/kernelspecs"):
+		s.handleKernelSpecs(w, r, trimPath(path, "/api/kernelspecs"))
+	case strings.HasPrefix(path, "/kernelspecs/"):
+		s.handleKernelSpecResource(w, r, trimPath(path, "/kernelspecs"))
+	case strings.HasPrefix(path, "/api/kernels"):
+		s.handleKernels(w, r, trimPath(path, "/api/kernels"))
+	case strings.HasPrefix(path, "/api/terminals"):
+		s.handleTerminals(w, r, trimPath(path, "/api/terminals"))
+	case strings.HasPrefix(path, "/api/config/"):
+		s.handleConfig(w, r, trimPath(path, "/api/config"))
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func trimPath(path string, prefix string) string {
+	return strings.Trim(strings.TrimPrefix(path, prefix), "/")
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000Z")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError replies with the body jupyter_server uses for api errors.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"message":   message,
+		"reason":    nil,
+		"traceback": nil,
+	})
+}
+
+func methodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connections := 0
+	for _, k := range s.kernels {
+		connections += len(k.conns)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"connections":   connections,
+		"kernels":       len(s.kernels),
+		"last_activity": timestamp(s.lastActivity),
+		"started":       timestamp(s.started),
+	})
+}
+
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	// the token grants every permission so requested permissions are echoed
+	permissions := api.Permissions{}
+	if raw := r.URL.Query().Get("permissions"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &permissions); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("permissions should be a JSON dict of {'resource': ['action',]}, got %q", raw))
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"identity": map[string]interface{}{
+			"username":     "jupytertest",
+			"name":         "jupytertest",
+			"display_name": "jupytertest",
+			"initials":     "J",
+			"avatar_url":   nil,
+			"color":        nil,
+		},
+		"permissions": permissions,
+	})
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request, section string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.config[section]
+	if !ok {
+		current = map[string]interface{}{}
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, current)
+	case http.MethodPatch:
+		var patch map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON in body of request")
+			return
+		}
+		mergeConfig(current, patch)
+		s.config[section] = current
+		writeJSON(w, http.StatusOK, current)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// mergeConfig applies patch recursively, nil values delete keys.
+func mergeConfig(target map[string]interface{}, patch map[string]interface{}) {
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		patchMap, patchIsMap := value.(map[string]interface{})
+		targetMap, targetIsMap := target[key].(map[string]interface{})
+		if patchIsMap && targetIsMap {
+			mergeConfig(targetMap, patchMap)
+			continue
+		}
+		if patchIsMap {
+			targetMap = map[string]interface{}{}
+			mergeConfig(targetMap, patchMap)
+			target[key] = targetMap
+			continue
+		}
+		target[key] = value
+	}
+}
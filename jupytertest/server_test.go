@@ -0,0 +1,439 @@
+package jupytertest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/costrouc/go-jupyterlab-api/api"
+	"github.com/costrouc/go-jupyterlab-api/nbformat"
+)
+
+func newTestClient(t *testing.T) (*Server, *api.ClientConfig) {
+	server := NewServer()
+	t.Cleanup(server.Close)
+	client, err := server.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func TestStatusVersionMe(t *testing.T) {
+	server, client := newTestClient(t)
+	ctx := context.Background()
+
+	version, err := client.GetVersion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Version != DefaultVersion {
+		t.Errorf("Expected version %s, got %s", DefaultVersion, version.Version)
+	}
+
+	if _, err := client.GetStatus(ctx); err != nil {
+		t.Error(err)
+	}
+
+	me, err := client.GetMe(ctx, &api.GetMeParams{Permissions: api.Permissions{"contents": {"read"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !me.Can("contents", "read") {
+		t.Errorf("Expected requested permission to be granted, got %v", me.Permissions)
+	}
+
+	badClient, err := api.CreateClient(&api.ClientConfig{ApiToken: "wrong"}, api.WithURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := badClient.GetStatus(ctx); !api.IsForbidden(err) {
+		t.Errorf("Expected forbidden error with an invalid token, got %v", err)
+	}
+}
+
+func TestContents(t *testing.T) {
+	_, client := newTestClient(t)
+	ctx := context.Background()
+
+	directory, err := client.CreateContents(ctx, "", &api.CreateContentsBody{Type: "directory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if directory.Name != "Untitled Folder" {
+		t.Errorf("Expected Untitled Folder, got %s", directory.Name)
+	}
+
+	file, err := client.CreateContents(ctx, directory.Path, &api.CreateContentsBody{Type: "file", Ext: ".txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Path != "Untitled Folder/untitled.txt" {
+		t.Errorf("Expected Untitled Folder/untitled.txt, got %s", file.Path)
+	}
+
+	if _, err := client.PutContents(ctx, file.Path, &api.PutContentsBody{Type: "file", Format: "text", Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := client.PatchContents(ctx, file.Path, &api.PatchContentsBody{Path: "Untitled Folder/hello.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := client.GetContents(ctx, renamed.Path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.Text() != "hello" {
+		t.Errorf("Expected hello, got %q", content.Text())
+	}
+
+	listing, err := client.GetContents(ctx, directory.Path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listing.Children()) != 1 {
+		t.Errorf("Expected one file in directory, got %v", listing.Children())
+	}
+
+	body, _, err := client.DownloadFile(ctx, renamed.Path, &api.DownloadFileOptions{Raw: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || string(data) != "hello" {
+		t.Errorf("Expected raw download hello, got %q %v", data, err)
+	}
+
+	upload := bytes.Repeat([]byte("0123456789"), 100)
+	if _, err := client.UploadFile(ctx, "upload.bin", bytes.NewReader(upload), &api.UploadFileOptions{ChunkSize: 64}); err != nil {
+		t.Fatal(err)
+	}
+	uploaded, err := client.GetContents(ctx, "upload.bin", &api.GetContentsParams{Type: "file", Format: "base64", Content: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(uploaded.Bytes(), upload) {
+		t.Errorf("Expected chunked upload to round trip, got %d bytes", len(uploaded.Bytes()))
+	}
+
+	if err := client.DeleteContents(ctx, renamed.Path); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.GetContents(ctx, renamed.Path, nil); !api.IsNotFound(err) {
+		t.Errorf("Expected not found after delete, got %v", err)
+	}
+}
+
+func TestNotebookAndCheckpoints(t *testing.T) {
+	_, client := newTestClient(t)
+	ctx := context.Background()
+
+	notebook := nbformat.New()
+	notebook.Cells = append(notebook.Cells, nbformat.Cell{CellType: nbformat.CellTypeCode, Source: nbformat.MultilineString("print(1)")})
+	if _, err := client.PutNotebook(ctx, "test.ipynb", notebook); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err := client.CreateCheckpoint(ctx, "test.ipynb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notebook.Cells = nil
+	if _, err := client.PutNotebook(ctx, "test.ipynb", notebook); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RestoreCheckpoint(ctx, "test.ipynb", checkpoint.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := client.GetNotebook(ctx, "test.ipynb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.Cells) != 1 || string(restored.Cells[0].Source) != "print(1)" {
+		t.Errorf("Expected restored notebook with one cell, got %v", restored.Cells)
+	}
+
+	if err := client.DeleteCheckpoint(ctx, "test.ipynb", checkpoint.Id); err != nil {
+		t.Error(err)
+	}
+	checkpoints, err := client.ListCheckpoints(ctx, "test.ipynb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*checkpoints) != 0 {
+		t.Errorf("Expected no checkpoints, got %v", *checkpoints)
+	}
+}
+
+func TestSessionsAndKernels(t *testing.T) {
+	_, client := newTestClient(t)
+	ctx := context.Background()
+
+	specs, err := client.GetKernelSpecs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if specs.Default != DefaultKernelSpec || len(specs.ByLanguage("python")) != 1 {
+		t.Errorf("Expected default python kernel spec, got %v", specs)
+	}
+	logo, err := client.GetKernelSpecResource(ctx, DefaultKernelSpec, "logo-32x32.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(logo, []byte("\x89PNG")) {
+		t.Errorf("Expected png logo")
+	}
+
+	session, err := client.CreateSession(ctx, &api.CreateSessionBody{Path: "test.ipynb", Type: "notebook", Kernel: api.SessionKernel{Name: DefaultKernelSpec}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := client.FindSessionByPath(ctx, "test.ipynb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.Id != session.Id {
+		t.Errorf("Expected to find session %s, got %v", session.Id, found)
+	}
+
+	kernel, err := client.GetKernel(ctx, session.Kernel.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kernel.ExecutionState != "idle" {
+		t.Errorf("Expected idle kernel, got %s", kernel.ExecutionState)
+	}
+	if err := client.InterruptKernel(ctx, kernel.Id); err != nil {
+		t.Error(err)
+	}
+	if err := client.RestartKernel(ctx, kernel.Id); err != nil {
+		t.Error(err)
+	}
+
+	if err := client.DeleteSession(ctx, session.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetKernel(ctx, kernel.Id); !api.IsNotFound(err) {
+		t.Errorf("Expected session kernel to be deleted, got %v", err)
+	}
+
+	if _, err := client.CreateKernel(ctx, api.CreateKernelBody{Name: "missing"}); !api.IsNotFound(err) {
+		t.Errorf("Expected not found for missing kernel spec, got %v", err)
+	}
+}
+
+func TestTerminalsAndConfig(t *testing.T) {
+	_, client := newTestClient(t)
+	ctx := context.Background()
+
+	terminal, err := client.CreateTerminal(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if terminal.Name != "1" {
+		t.Errorf("Expected terminal 1, got %s", terminal.Name)
+	}
+	if err := client.DeleteTerminal(ctx, terminal.Name); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.GetTerminal(ctx, terminal.Name); !api.IsNotFound(err) {
+		t.Errorf("Expected deleted terminal to be not found, got %v", err)
+	}
+
+	_, err = client.PatchConfigSection(ctx, "notebook", api.ConfigSection{"Cell": map[string]interface{}{"cm_config": map[string]interface{}{"lineNumbers": true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	section, err := client.GetConfigSection(ctx, "notebook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cell, _ := (*section)["Cell"].(map[string]interface{})
+	cmConfig, _ := cell["cm_config"].(map[string]interface{})
+	if cmConfig["lineNumbers"] != true {
+		t.Errorf("Expected patched config section, got %v", *section)
+	}
+}
+
+func TestKernelExecute(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Execute = func(code string) []KernelOutput {
+		switch code {
+		case "print('hello')":
+			return []KernelOutput{Stream("stdout", "hello\n")}
+		case "1 + 1":
+			return []KernelOutput{ExecuteResult(map[string]interface{}{"text/plain": "2"})}
+		case "1 / 0":
+			return []KernelOutput{Error("ZeroDivisionError", "division by zero")}
+		}
+		return nil
+	}
+	ctx := context.Background()
+
+	kernel, err := client.CreateKernel(ctx, api.CreateKernelBody{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.ConnectKernel(ctx, kernel.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	info, err := conn.KernelInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Status != "ok" || info.LanguageInfo["name"] != "python" {
+		t.Errorf("Expected python kernel info, got %v", info)
+	}
+
+	result, err := conn.Execute(ctx, "print('hello')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reply.Status != "ok" || result.Reply.ExecutionCount != 1 {
+		t.Errorf("Expected ok reply with execution count 1, got %v", result.Reply)
+	}
+	var streamed []string
+	for _, msg := range result.IOPub {
+		if msg.Header.MsgType == "stream" {
+			var stream api.StreamContent
+			if err := json.Unmarshal(msg.Content, &stream); err != nil {
+				t.Fatal(err)
+			}
+			streamed = append(streamed, stream.Text)
+		}
+	}
+	if len(streamed) != 1 || streamed[0] != "hello\n" {
+		t.Errorf("Expected stream output hello, got %v", streamed)
+	}
+
+	result, err = conn.Execute(ctx, "1 + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range result.IOPub {
+		if msg.Header.MsgType == "execute_result" {
+			var content api.ExecuteResultContent
+			if err := json.Unmarshal(msg.Content, &content); err != nil {
+				t.Fatal(err)
+			}
+			if content.ExecutionCount != 2 || content.Data["text/plain"] != "2" {
+				t.Errorf("Expected execute result 2 with execution count 2, got %v", content)
+			}
+		}
+	}
+
+	result, err = conn.Execute(ctx, "1 / 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reply.Status != "error" || result.Reply.Ename != "ZeroDivisionError" {
+		t.Errorf("Expected ZeroDivisionError reply, got %v", result.Reply)
+	}
+}
+
+func TestKernelInterruptShutdown(t *testing.T) {
+	server, client := newTestClient(t)
+	server.Execute = func(code string) []KernelOutput {
+		return []KernelOutput{Stream("stdout", "sleeping\n"), WaitForInterrupt()}
+	}
+	ctx := context.Background()
+
+	kernel, err := client.CreateKernel(ctx, api.CreateKernelBody{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.ConnectKernel(ctx, kernel.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	results := make(chan *api.ExecuteResult, 1)
+	go func() {
+		result, err := conn.Execute(ctx, "time.sleep(60)")
+		if err != nil {
+			t.Error(err)
+		}
+		results <- result
+	}()
+
+	for {
+		kernel, err := client.GetKernel(ctx, kernel.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kernel.ExecutionState == "busy" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := conn.Interrupt(ctx); err != nil {
+		t.Fatal(err)
+	}
+	result := <-results
+	if result == nil || result.Reply.Status != "error" || result.Reply.Ename != "KeyboardInterrupt" {
+		t.Errorf("Expected KeyboardInterrupt reply, got %v", result)
+	}
+
+	if err := conn.Shutdown(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetKernel(ctx, kernel.Id); !api.IsNotFound(err) {
+		t.Errorf("Expected kernel to be removed after shutdown, got %v", err)
+	}
+}
+
+func TestKernelInterruptBeforeWait(t *testing.T) {
+	server, client := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	kernel, err := client.CreateKernel(ctx, api.CreateKernelBody{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the interrupt arrives while busy but before the execution waits for it
+	server.Execute = func(code string) []KernelOutput {
+		if code != "time.sleep(60)" {
+			return nil
+		}
+		if err := client.InterruptKernel(ctx, kernel.Id); err != nil {
+			t.Error(err)
+		}
+		return []KernelOutput{WaitForInterrupt()}
+	}
+	conn, err := client.ConnectKernel(ctx, kernel.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	result, err := conn.Execute(ctx, "time.sleep(60)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reply.Status != "error" || result.Reply.Ename != "KeyboardInterrupt" {
+		t.Errorf("Expected KeyboardInterrupt reply, got %v", result.Reply)
+	}
+
+	// an interrupt while idle is not delivered to the next execution
+	if err := client.InterruptKernel(ctx, kernel.Id); err != nil {
+		t.Fatal(err)
+	}
+	result, err = conn.Execute(ctx, "1 + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reply.Status != "ok" {
+		t.Errorf("Expected idle interrupt to be dropped, got %v", result.Reply)
+	}
+}
@@ -0,0 +1,523 @@
+// Package nbformat models version 4 Jupyter notebooks. Every type keeps
+// fields it does not know about in Extra so that reading and writing a
+// notebook does not drop metadata added by extensions or newer minor versions.
+package nbformat
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	NbformatMajor = 4
+	NbformatMinor = 5
+)
+
+type Notebook struct {
+	Nbformat      int
+	NbformatMinor int
+	Metadata      NotebookMetadata
+	Cells         []Cell
+	Extra         map[string]json.RawMessage
+}
+
+type NotebookMetadata struct {
+	Kernelspec   *KernelspecMetadata
+	LanguageInfo *LanguageInfoMetadata
+	Extra        map[string]json.RawMessage
+}
+
+type KernelspecMetadata struct {
+	Name        string
+	DisplayName string
+	Language    string
+	Extra       map[string]json.RawMessage
+}
+
+type LanguageInfoMetadata struct {
+	Name           string
+	Version        string
+	MimeType       string
+	FileExtension  string
+	CodemirrorMode json.RawMessage
+	PygmentsLexer  string
+	// Extra keeps keys such as nbconvert_exporter
+	Extra map[string]json.RawMessage
+}
+
+// Metadata holds cell and output metadata as raw json values.
+type Metadata map[string]json.RawMessage
+
+// MimeBundle maps a mimetype to its raw json value. Text mimetypes are usually
+// stored as a string or a list of lines.
+type MimeBundle map[string]json.RawMessage
+
+const (
+	CellTypeCode     = "code"
+	CellTypeMarkdown = "markdown"
+	CellTypeRaw      = "raw"
+)
+
+type Cell struct {
+	Id          string
+	CellType    string
+	Metadata    Metadata
+	Source      MultilineString
+	Attachments map[string]MimeBundle
+	// only used by code cells, a nil ExecutionCount is written as null
+	ExecutionCount *int
+	Outputs        []Output
+	Extra          map[string]json.RawMessage
+}
+
+const (
+	OutputTypeStream        = "stream"
+	OutputTypeDisplayData   = "display_data"
+	OutputTypeExecuteResult = "execute_result"
+	OutputTypeError         = "error"
+)
+
+type Output struct {
+	OutputType string
+	// stream
+	Name string
+	Text MultilineString
+	// display_data and execute_result
+	Data           MimeBundle
+	Metadata       Metadata
+	ExecutionCount *int
+	// error
+	Ename     string
+	Evalue    string
+	Traceback []string
+	Extra     map[string]json.RawMessage
+}
+
+// MultilineString is a string stored either as a single json string or a list
+// of lines. It is always written as a list of lines, like nbformat does.
+type MultilineString string
+
+func (s *MultilineString) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = MultilineString(str)
+		return nil
+	}
+
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return fmt.Errorf("nbformat: multiline string must be a string or list of strings: %w", err)
+	}
+	*s = MultilineString(strings.Join(lines, ""))
+	return nil
+}
+
+func (s MultilineString) MarshalJSON() ([]byte, error) {
+	return marshal(s.Lines())
+}
+
+// Lines splits the string keeping the trailing newline on each line.
+func (s MultilineString) Lines() []string {
+	lines := []string{}
+	rest := string(s)
+	for rest != "" {
+		i := strings.IndexByte(rest, '\n')
+		if i < 0 {
+			lines = append(lines, rest)
+			break
+		}
+		lines = append(lines, rest[:i+1])
+		rest = rest[i+1:]
+	}
+	return lines
+}
+
+func New() *Notebook {
+	return &Notebook{
+		Nbformat:      NbformatMajor,
+		NbformatMinor: NbformatMinor,
+		Cells:         []Cell{},
+	}
+}
+
+func Read(r io.Reader) (*Notebook, error) {
+	var nb Notebook
+	if err := json.NewDecoder(r).Decode(&nb); err != nil {
+		return nil, err
+	}
+	return &nb, nil
+}
+
+// Write encodes the notebook with a one space indent as written by jupyter.
+func Write(w io.Writer, nb *Notebook) error {
+	data, err := marshal(nb)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", " "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func (nb *Notebook) UnmarshalJSON(data []byte) error {
+	fields, err := splitFields(data)
+	if err != nil {
+		return err
+	}
+	if err := takeField(fields, "nbformat", &nb.Nbformat); err != nil {
+		return err
+	}
+	if err := takeField(fields, "nbformat_minor", &nb.NbformatMinor); err != nil {
+		return err
+	}
+	if err := takeField(fields, "metadata", &nb.Metadata); err != nil {
+		return err
+	}
+	if err := takeField(fields, "cells", &nb.Cells); err != nil {
+		return err
+	}
+	if nb.Nbformat != NbformatMajor {
+		return fmt.Errorf("nbformat: unsupported notebook version %d", nb.Nbformat)
+	}
+	nb.Extra = extraFields(fields)
+	return nil
+}
+
+func (nb Notebook) MarshalJSON() ([]byte, error) {
+	cells := nb.Cells
+	if cells == nil {
+		cells = []Cell{}
+	}
+	if nb.Nbformat == NbformatMajor && nb.NbformatMinor >= 5 {
+		cells = withCellIds(cells)
+	}
+	return joinFields(nb.Extra, map[string]interface{}{
+		"nbformat":       nb.Nbformat,
+		"nbformat_minor": nb.NbformatMinor,
+		"metadata":       nb.Metadata,
+		"cells":          cells,
+	})
+}
+
+// withCellIds returns a copy of cells where cells without an id get a random
+// one, ids are required since nbformat 4.5.
+func withCellIds(cells []Cell) []Cell {
+	ids := make(map[string]bool, len(cells))
+	missing := false
+	for _, cell := range cells {
+		ids[cell.Id] = true
+		missing = missing || cell.Id == ""
+	}
+	if !missing {
+		return cells
+	}
+
+	cells = append([]Cell{}, cells...)
+	for i := range cells {
+		for cells[i].Id == "" {
+			if id := randomCellId(); !ids[id] {
+				ids[id] = true
+				cells[i].Id = id
+			}
+		}
+	}
+	return cells
+}
+
+// randomCellId matches the 8 hex characters nbformat generates.
+func randomCellId() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return fmt.Sprintf("%x", b)
+}
+
+func (m *NotebookMetadata) UnmarshalJSON(data []byte) error {
+	fields, err := splitFields(data)
+	if err != nil {
+		return err
+	}
+	if err := takeField(fields, "kernelspec", &m.Kernelspec); err != nil {
+		return err
+	}
+	if err := takeField(fields, "language_info", &m.LanguageInfo); err != nil {
+		return err
+	}
+	m.Extra = extraFields(fields)
+	return nil
+}
+
+func (m NotebookMetadata) MarshalJSON() ([]byte, error) {
+	known := map[string]interface{}{}
+	if m.Kernelspec != nil {
+		known["kernelspec"] = m.Kernelspec
+	}
+	if m.LanguageInfo != nil {
+		known["language_info"] = m.LanguageInfo
+	}
+	return joinFields(m.Extra, known)
+}
+
+func (k *KernelspecMetadata) UnmarshalJSON(data []byte) error {
+	fields, err := splitFields(data)
+	if err != nil {
+		return err
+	}
+	if err := takeField(fields, "name", &k.Name); err != nil {
+		return err
+	}
+	if err := takeField(fields, "display_name", &k.DisplayName); err != nil {
+		return err
+	}
+	if err := takeField(fields, "language", &k.Language); err != nil {
+		return err
+	}
+	k.Extra = extraFields(fields)
+	return nil
+}
+
+func (k KernelspecMetadata) MarshalJSON() ([]byte, error) {
+	known := map[string]interface{}{
+		"name":         k.Name,
+		"display_name": k.DisplayName,
+	}
+	if k.Language != "" {
+		known["language"] = k.Language
+	}
+	return joinFields(k.Extra, known)
+}
+
+func (l *LanguageInfoMetadata) UnmarshalJSON(data []byte) error {
+	fields, err := splitFields(data)
+	if err != nil {
+		return err
+	}
+	for key, v := range map[string]interface{}{
+		"name":            &l.Name,
+		"version":         &l.Version,
+		"mimetype":        &l.MimeType,
+		"file_extension":  &l.FileExtension,
+		"codemirror_mode": &l.CodemirrorMode,
+		"pygments_lexer":  &l.PygmentsLexer,
+	} {
+		if err := takeField(fields, key, v); err != nil {
+			return err
+		}
+	}
+	l.Extra = extraFields(fields)
+	return nil
+}
+
+func (l LanguageInfoMetadata) MarshalJSON() ([]byte, error) {
+	known := map[string]interface{}{"name": l.Name}
+	for key, value := range map[string]string{
+		"version":        l.Version,
+		"mimetype":       l.MimeType,
+		"file_extension": l.FileExtension,
+		"pygments_lexer": l.PygmentsLexer,
+	} {
+		if value != "" {
+			known[key] = value
+		}
+	}
+	if len(l.CodemirrorMode) > 0 {
+		known["codemirror_mode"] = l.CodemirrorMode
+	}
+	return joinFields(l.Extra, known)
+}
+
+func (c *Cell) UnmarshalJSON(data []byte) error {
+	fields, err := splitFields(data)
+	if err != nil {
+		return err
+	}
+	if err := takeField(fields, "id", &c.Id); err != nil {
+		return err
+	}
+	if err := takeField(fields, "cell_type", &c.CellType); err != nil {
+		return err
+	}
+	if err := takeField(fields, "metadata", &c.Metadata); err != nil {
+		return err
+	}
+	if err := takeField(fields, "source", &c.Source); err != nil {
+		return err
+	}
+	if err := takeField(fields, "attachments", &c.Attachments); err != nil {
+		return err
+	}
+	if c.CellType == CellTypeCode {
+		if err := takeField(fields, "execution_count", &c.ExecutionCount); err != nil {
+			return err
+		}
+		if err := takeField(fields, "outputs", &c.Outputs); err != nil {
+			return err
+		}
+	}
+	c.Extra = extraFields(fields)
+	return nil
+}
+
+func (c Cell) MarshalJSON() ([]byte, error) {
+	metadata := c.Metadata
+	if metadata == nil {
+		metadata = Metadata{}
+	}
+	known := map[string]interface{}{
+		"cell_type": c.CellType,
+		"metadata":  metadata,
+		"source":    c.Source,
+	}
+	if c.Id != "" {
+		known["id"] = c.Id
+	}
+	if c.Attachments != nil {
+		known["attachments"] = c.Attachments
+	}
+	if c.CellType == CellTypeCode {
+		outputs := c.Outputs
+		if outputs == nil {
+			outputs = []Output{}
+		}
+		known["execution_count"] = c.ExecutionCount
+		known["outputs"] = outputs
+	}
+	return joinFields(c.Extra, known)
+}
+
+func (o *Output) UnmarshalJSON(data []byte) error {
+	fields, err := splitFields(data)
+	if err != nil {
+		return err
+	}
+	if err := takeField(fields, "output_type", &o.OutputType); err != nil {
+		return err
+	}
+
+	switch o.OutputType {
+	case OutputTypeStream:
+		if err := takeField(fields, "name", &o.Name); err != nil {
+			return err
+		}
+		if err := takeField(fields, "text", &o.Text); err != nil {
+			return err
+		}
+	case OutputTypeDisplayData, OutputTypeExecuteResult:
+		if err := takeField(fields, "data", &o.Data); err != nil {
+			return err
+		}
+		if err := takeField(fields, "metadata", &o.Metadata); err != nil {
+			return err
+		}
+		if o.OutputType == OutputTypeExecuteResult {
+			if err := takeField(fields, "execution_count", &o.ExecutionCount); err != nil {
+				return err
+			}
+		}
+	case OutputTypeError:
+		if err := takeField(fields, "ename", &o.Ename); err != nil {
+			return err
+		}
+		if err := takeField(fields, "evalue", &o.Evalue); err != nil {
+			return err
+		}
+		if err := takeField(fields, "traceback", &o.Traceback); err != nil {
+			return err
+		}
+	}
+	o.Extra = extraFields(fields)
+	return nil
+}
+
+func (o Output) MarshalJSON() ([]byte, error) {
+	known := map[string]interface{}{
+		"output_type": o.OutputType,
+	}
+	switch o.OutputType {
+	case OutputTypeStream:
+		known["name"] = o.Name
+		known["text"] = o.Text
+	case OutputTypeDisplayData, OutputTypeExecuteResult:
+		data, metadata := o.Data, o.Metadata
+		if data == nil {
+			data = MimeBundle{}
+		}
+		if metadata == nil {
+			metadata = Metadata{}
+		}
+		known["data"] = data
+		known["metadata"] = metadata
+		if o.OutputType == OutputTypeExecuteResult {
+			known["execution_count"] = o.ExecutionCount
+		}
+	case OutputTypeError:
+		traceback := o.Traceback
+		if traceback == nil {
+			traceback = []string{}
+		}
+		known["ename"] = o.Ename
+		known["evalue"] = o.Evalue
+		known["traceback"] = traceback
+	}
+	return joinFields(o.Extra, known)
+}
+
+func splitFields(data []byte) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// takeField decodes key into v and removes it so only unknown keys remain.
+func takeField(fields map[string]json.RawMessage, key string, v interface{}) error {
+	raw, ok := fields[key]
+	if !ok {
+		return nil
+	}
+	delete(fields, key)
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("nbformat: decoding %q: %w", key, err)
+	}
+	return nil
+}
+
+func extraFields(fields map[string]json.RawMessage) map[string]json.RawMessage {
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// joinFields marshals known and extra keys into one object. Go sorts map keys
+// which matches the sort_keys ordering used when jupyter writes notebooks.
+func joinFields(extra map[string]json.RawMessage, known map[string]interface{}) ([]byte, error) {
+	fields := make(map[string]interface{}, len(extra)+len(known))
+	for key, value := range extra {
+		fields[key] = value
+	}
+	for key, value := range known {
+		fields[key] = value
+	}
+	return marshal(fields)
+}
+
+// marshal is json.Marshal without escaping <, > and & so html outputs are
+// written like jupyter writes them.
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
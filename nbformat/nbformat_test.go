@@ -0,0 +1,169 @@
+package nbformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testNotebook = `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "id": "a1",
+   "metadata": {"tags": ["intro"]},
+   "source": ["# Title\n", "some text"]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": 2,
+   "id": "b2",
+   "metadata": {"collapsed": false, "custom_extension": {"answer": 42.0}},
+   "outputs": [
+    {"name": "stdout", "output_type": "stream", "text": ["hello\n", "world\n"]},
+    {"data": {"text/plain": ["3"], "application/json": {"a": [1, 2]}}, "execution_count": 2, "metadata": {}, "output_type": "execute_result"},
+    {"data": {"image/png": "aGVsbG8="}, "metadata": {"image/png": {"width": 10}}, "output_type": "display_data", "transient_extension": true},
+    {"data": {"text/html": ["<b>a & b</b>"]}, "metadata": {}, "output_type": "display_data"},
+    {"ename": "ValueError", "evalue": "bad", "output_type": "error", "traceback": ["line 1", "line 2"]}
+   ],
+   "source": ["print('hello')\n", "1 + 2"]
+  },
+  {
+   "cell_type": "raw",
+   "id": "c3",
+   "metadata": {"format": "text/restructuredtext"},
+   "source": []
+  }
+ ],
+ "metadata": {
+  "kernelspec": {"display_name": "Python 3", "env": {"PYTHONPATH": "src"}, "language": "python", "name": "python3"},
+  "language_info": {"codemirror_mode": {"name": "ipython", "version": 3}, "name": "python", "nbconvert_exporter": "python", "version": "3.11.0"},
+  "widgets": {"state": {}}
+ },
+ "nbformat": 4,
+ "nbformat_minor": 5,
+ "top_level_extension": "kept"
+}`
+
+func normalize(t *testing.T, data []byte) interface{} {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestRoundTrip(t *testing.T) {
+	nb, err := Read(strings.NewReader(testNotebook))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nb.Metadata.Kernelspec == nil || nb.Metadata.Kernelspec.Name != "python3" {
+		t.Errorf("Expected kernelspec name python3, got %v", nb.Metadata.Kernelspec)
+	}
+	if len(nb.Cells) != 3 {
+		t.Fatalf("Expected 3 cells, got %d", len(nb.Cells))
+	}
+	if nb.Cells[1].Source != "print('hello')\n1 + 2" {
+		t.Errorf("Expected joined code cell source, got %q", nb.Cells[1].Source)
+	}
+	if *nb.Cells[1].ExecutionCount != 2 {
+		t.Errorf("Expected execution count 2, got %d", *nb.Cells[1].ExecutionCount)
+	}
+	if nb.Cells[1].Outputs[4].Ename != "ValueError" {
+		t.Errorf("Expected error output ename ValueError, got %s", nb.Cells[1].Outputs[4].Ename)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, nb); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(normalize(t, []byte(testNotebook)), normalize(t, buf.Bytes())) {
+		t.Errorf("Notebook did not round trip, got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"<b>a & b</b>"`) {
+		t.Errorf("Expected html characters to be written unescaped, got %s", buf.String())
+	}
+	expected := `"kernelspec": {
+   "display_name": "Python 3",
+   "env": {
+    "PYTHONPATH": "src"
+   },
+   "language": "python",
+   "name": "python3"
+  },`
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("Expected kernelspec keys to be sorted, got %s", buf.String())
+	}
+}
+
+func TestMultilineString(t *testing.T) {
+	var s MultilineString
+	if err := json.Unmarshal([]byte(`"a\nb\n"`), &s); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `["a\n","b\n"]` {
+		t.Errorf("Expected multiline string to be written as lines, got %s", data)
+	}
+}
+
+func TestNewNotebook(t *testing.T) {
+	nb := New()
+	nb.Cells = append(nb.Cells, Cell{Id: "x1", CellType: CellTypeCode, Source: "x = 1"})
+
+	data, err := json.Marshal(nb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"cells":[{"cell_type":"code","execution_count":null,"id":"x1","metadata":{},"outputs":[],"source":["x = 1"]}],"metadata":{},"nbformat":4,"nbformat_minor":5}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+}
+
+func TestCellIds(t *testing.T) {
+	nb := New()
+	nb.Cells = append(nb.Cells,
+		Cell{CellType: CellTypeCode, Source: "x = 1"},
+		Cell{Id: "kept", CellType: CellTypeMarkdown, Source: "# x"},
+		Cell{CellType: CellTypeRaw},
+	)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, nb); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for i, cell := range read.Cells {
+		if cell.Id == "" || ids[cell.Id] {
+			t.Errorf("Expected cell %d to get a unique id, got %q", i, cell.Id)
+		}
+		ids[cell.Id] = true
+	}
+	if read.Cells[1].Id != "kept" {
+		t.Errorf("Expected existing cell id to be kept, got %q", read.Cells[1].Id)
+	}
+	if nb.Cells[0].Id != "" {
+		t.Errorf("Expected writing to leave the notebook unchanged, got id %q", nb.Cells[0].Id)
+	}
+
+	nb.NbformatMinor = 4
+	data, err := json.Marshal(nb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), `"id"`) != 1 {
+		t.Errorf("Expected no generated ids before nbformat 4.5, got %s", data)
+	}
+}